@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
 
 	"github.com/IBM/ubiquity-k8s/sidecars/flex"
+	"github.com/IBM/ubiquity-k8s/utils"
+	"github.com/IBM/ubiquity-k8s/utils/health"
 	utilsk8s "github.com/IBM/ubiquity-k8s/utils/kubernetes"
 	"k8s.io/client-go/kubernetes"
 )
@@ -15,12 +19,25 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	go serveHealth(clientset, s)
 	err = s.Sync()
 	if err != nil {
 		panic(err)
 	}
 }
 
+func serveHealth(clientset kubernetes.Interface, s *flex.ServiceSyncer) {
+	checker := health.NewChecker()
+	checker.AddReadinessCheck("ubiquity", s.CheckUbiquityConnectivity)
+	checker.AddReadinessCheck("kubernetes", func() error {
+		_, err := clientset.Discovery().ServerVersion()
+		return err
+	})
+	if err := checker.ListenAndServe(utils.GetHealthAddress()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to serve health: %v\n", err)
+	}
+}
+
 func getClientset() kubernetes.Interface {
 	return utilsk8s.GetClientset("Ubiquity flex sidecar")
 }
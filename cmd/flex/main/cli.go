@@ -72,10 +72,43 @@ type GetVolumeNameCommand struct {
 }
 
 func (g *GetVolumeNameCommand) Execute(args []string) error {
-	// This GetVolumeName action in FlexVolume CLI is not relevant, we can just return not supported without logging anything.
-	response := k8sresources.FlexVolumeResponse{
-		Status: "Not supported",
+	requestContext := logs.GetNewRequestContext("GetVolumeName")
+	if len(args) < 1 {
+
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Not enough arguments to getVolumeName call out"),
+		}
+		return printResponse(response)
+	}
+	config, err := readConfig(*configFile)
+	if err != nil {
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to read config in getVolumeName %#v", err),
+		}
+		return printResponse(response)
+	}
+	defer k8sutils.InitFlexLogger(config)()
+	controller, err := createController(config)
+	if err != nil {
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in getVolumeName %#v", err),
+		}
+		return printResponse(response)
+	}
+	opts := make(map[string]string)
+	err = json.Unmarshal([]byte(args[0]), &opts)
+	if err != nil {
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to marshall args in getVolumeName %#v", err),
+		}
+		return printResponse(response)
 	}
+	getVolumeNameRequest := k8sresources.FlexVolumeGetVolumeNameRequest{Opts: opts, Context: requestContext}
+	response := controller.GetVolumeName(getVolumeNameRequest)
 	return printResponse(response)
 }
 
@@ -125,9 +158,12 @@ func (a *AttachCommand) Execute(args []string) error {
 	}
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
-
 	if err != nil {
-		panic(fmt.Sprintf("backend %s not found", config))
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in attach %#v", err),
+		}
+		return printResponse(response)
 	}
 
 	volumeName, ok := attachRequestOpts["volumeName"]
@@ -171,6 +207,13 @@ func (wfa *WaitForAttachCommand) Execute(args []string) error {
 	}
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
+	if err != nil {
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in waitForAttach %#v", err),
+		}
+		return printResponse(response)
+	}
 	opts := make(map[string]string)
 	err = json.Unmarshal([]byte(args[1]), &opts)
 	if err != nil {
@@ -211,6 +254,13 @@ func (d *IsAttachedCommand) Execute(args []string) error {
 	}
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
+	if err != nil {
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in isAttached %#v", err),
+		}
+		return printResponse(response)
+	}
 	opts := make(map[string]string)
 	err = json.Unmarshal([]byte(args[0]), &opts)
 	if err != nil {
@@ -262,9 +312,12 @@ func (d *DetachCommand) Execute(args []string) error {
 	}
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
-
 	if err != nil {
-		panic("backend not found")
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in detach %#v", err),
+		}
+		return printResponse(response)
 	}
 
 	detachRequest := k8sresources.FlexVolumeDetachRequest{Name: mountDevice, Host: hostname, Version: version, Context: requestContext}
@@ -298,6 +351,13 @@ func (d *MountDeviceCommand) Execute(args []string) error {
 	}
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
+	if err != nil {
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in MountDevice %#v", err),
+		}
+		return printResponse(response)
+	}
 	opts := make(map[string]string)
 	err = json.Unmarshal([]byte(args[2]), &opts)
 	if err != nil {
@@ -338,6 +398,13 @@ func (d *UnmountDeviceCommand) Execute(args []string) error {
 	}
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
+	if err != nil {
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in UnmountDevice %#v", err),
+		}
+		return printResponse(response)
+	}
 
 	unmountDeviceRequest := k8sresources.FlexVolumeUnmountDeviceRequest{Name: args[0], Context: requestContext}
 	response := controller.UnmountDevice(unmountDeviceRequest)
@@ -422,9 +489,12 @@ func (m *MountCommand) Execute(args []string) error {
 
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
-
 	if err != nil {
-		panic("backend not found")
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in mount %#v", err),
+		}
+		return printResponse(response)
 	}
 	mountResponse := controller.Mount(mountRequest)
 
@@ -460,9 +530,12 @@ func (u *UnmountCommand) Execute(args []string) error {
 
 	defer k8sutils.InitFlexLogger(config)()
 	controller, err := createController(config)
-
 	if err != nil {
-		panic("backend not found")
+		response := k8sresources.FlexVolumeResponse{
+			Status:  "Failure",
+			Message: fmt.Sprintf("Failed to create controller in Unmount %#v", err),
+		}
+		return printResponse(response)
 	}
 
 	unmountRequest := k8sresources.FlexVolumeUnmountRequest{
@@ -572,10 +645,22 @@ func main() {
 
 func createController(config resources.UbiquityPluginConfig) (*controller.Controller, error) {
 	logger := utils.SetupOldLogger(k8sresources.UbiquityFlexLogFileName)
-	controller, err := controller.NewController(logger, config)
+	flexConfig, err := readFlexConfig(*configFile)
+	if err != nil {
+		return nil, err
+	}
+	controller, err := controller.NewController(logger, config, flexConfig)
 	return controller, err
 }
 
+func readFlexConfig(configFile string) (k8sresources.UbiquityK8sFlexConfig, error) {
+	var flexConfig k8sresources.UbiquityK8sFlexConfig
+	if _, err := toml.DecodeFile(configFile, &flexConfig); err != nil {
+		return k8sresources.UbiquityK8sFlexConfig{}, err
+	}
+	return flexConfig, nil
+}
+
 func readConfig(configFile string) (resources.UbiquityPluginConfig, error) {
 	var config resources.UbiquityPluginConfig
 	if _, err := toml.DecodeFile(configFile, &config); err != nil {
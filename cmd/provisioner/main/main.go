@@ -18,30 +18,47 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
 
 	"flag"
 	k8sresources "github.com/IBM/ubiquity-k8s/resources"
 	k8sutils "github.com/IBM/ubiquity-k8s/utils"
+	uberrors "github.com/IBM/ubiquity-k8s/utils/errors"
+	"github.com/IBM/ubiquity-k8s/utils/health"
+	utilsk8s "github.com/IBM/ubiquity-k8s/utils/kubernetes"
 	"github.com/IBM/ubiquity-k8s/volume"
 	"github.com/IBM/ubiquity/remote"
 	"github.com/IBM/ubiquity/utils"
 	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 	"os"
 )
 
 var (
 	provisioner = k8sresources.ProvisionerName
+
+	kubeconfig  = flag.String("kubeconfig", "", "Path to a kubeconfig file, to run the provisioner out of the cluster.")
+	kubecontext = flag.String("context", "", "The kubeconfig context to use, the current context of the kubeconfig if empty.")
 )
 
 func main() {
 
-	/* this is fixing an existing issue with glog in kuberenetes in version 1.9
-	if we ever move to a newer code version this can be removed.
-	*/
-	flag.CommandLine.Parse([]string{})
+	// Parse the kubeconfig and the glog flags, parsing also stops glog of the kubernetes client from logging
+	// "ERROR: logging before flag.Parse" on every message.
+	flag.CommandLine.Parse(os.Args[1:])
 
 	ubiquityConfig, err := k8sutils.LoadConfig()
 	if err != nil {
@@ -58,12 +75,20 @@ func main() {
 
 	logger.Printf("Provisioner %s specified", provisioner)
 
-	var config *rest.Config
+	// Serve the metrics on every replica, so the standby replicas are monitored as well.
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = k8sutils.DefaultMetricsPort
+	}
+	go serveMetrics(logger, ":"+metricsPort)
 
-	config, err = rest.InClusterConfig()
+	// The provisioner runs out of cluster with the given kubeconfig, or with the default kubeconfig when it is not in a pod.
+	outOfCluster := *kubeconfig != "" || os.Getenv("KUBERNETES_SERVICE_HOST") == ""
+	config, err := utilsk8s.Config(*kubeconfig, *kubecontext, k8sresources.UbiquityProvisionerName)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to create k8s InClusterConfig: %v", err))
+		panic(fmt.Sprintf("Failed to create k8s config: %v", err))
 	}
+	logger.Printf("Connecting to kubernetes %s, out of cluster %t", config.Host, outOfCluster)
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to create client: %v", err))
@@ -81,19 +106,119 @@ func main() {
 		panic("Error getting remote client")
 	}
 
+	// The leader election lock and the volume ownership are in the namespace of the pod, or of the kubeconfig context out of cluster, unless NAMESPACE is set.
+	defaultNamespace, err := utilsk8s.Namespace(*kubeconfig, *kubecontext)
+	if err != nil {
+		logger.Printf("Failed to get the namespace of the kubeconfig: %v", err)
+	}
+	leaderElectionConfig, err := k8sutils.LoadLeaderElectionConfig(defaultNamespace)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load leader election config: %v", err))
+	}
+	if leaderElectionConfig.Namespace == "" {
+		panic(fmt.Sprintf("Failed to get the namespace of the provisioner: %v", uberrors.ENVNamespaceNotSet))
+	}
+	// The provisioner adopts, and the reconciler deletes, only the volumes that it recorded in the ownership ConfigMap.
+	ownership := volume.NewVolumeOwnership(clientset, leaderElectionConfig.Namespace, k8sutils.VolumeOwnershipConfigMapName)
+
 	// Create the provisioner: it implements the Provisioner interface expected by
 	// the controller
 	ubiquityConfigCopyWithPasswordStarred := ubiquityConfig
 	ubiquityConfigCopyWithPasswordStarred.CredentialInfo.Password = "****"
 	logger.Printf("starting the provisioner, remote client %#v, config %#v", remoteClient, ubiquityConfigCopyWithPasswordStarred)
-	flexProvisioner, err := volume.NewFlexProvisioner(logger, remoteClient, ubiquityConfig)
+	// The provisioner starts even if the backends cannot be activated yet, it is not ready until they are.
+	flexProvisioner, err := volume.NewFlexProvisioner(logger, remoteClient, clientset, ownership, ubiquityConfig)
 	if err != nil {
 		logger.Printf("Error starting provisioner: %v", err)
 		panic("Error starting ubiquity provisioner")
 	}
 
-	// Start the provision controller which will dynamically provision Ubiquity PVs
+	// Serve the health on every replica, the standby replicas are ready as well so they can take over the leadership.
+	checker := health.NewChecker()
+	ubiquityAddress := net.JoinHostPort(ubiquityConfig.UbiquityServer.Address, strconv.Itoa(ubiquityConfig.UbiquityServer.Port))
+	checker.AddReadinessCheck("ubiquity", health.DialCheck(ubiquityAddress, k8sutils.HealthCheckTimeout))
+	checker.AddReadinessCheck("activation", flexProvisioner.CheckActivated)
+	checker.AddReadinessCheck("kubernetes", func() error {
+		_, err := clientset.Discovery().ServerVersion()
+		return err
+	})
+	go func() {
+		healthAddress := k8sutils.GetHealthAddress()
+		logger.Printf("Serving health on %s", healthAddress)
+		if err := checker.ListenAndServe(healthAddress); err != nil {
+			logger.Printf("Failed to serve health: %v", err)
+		}
+	}()
+
+	reconcilerConfig, err := k8sutils.LoadReconcilerConfig()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load reconciler config: %v", err))
+	}
+
+	// Only the leader changes the backend volumes, so all the controllers run only while leading.
+	run := func(stopCh <-chan struct{}) {
+		// Start the reconciler which will report (and optionally delete) the orphan volumes of Ubiquity and the PVs with missing volumes
+		if reconcilerConfig.Period > 0 {
+			reconciler := volume.NewFlexReconciler(clientset, remoteClient, ownership, reconcilerConfig.DeleteOrphans, reconcilerConfig.GracePeriod)
+			go reconciler.Run(reconcilerConfig.Period, stopCh)
+		}
+
+		// Start the provision controller which will dynamically provision Ubiquity PVs
+		pc := controller.NewProvisionController(clientset, provisioner, flexProvisioner, serverVersion.GitVersion)
+		pc.Run(stopCh)
+	}
 
-	pc := controller.NewProvisionController(clientset, provisioner, flexProvisioner, serverVersion.GitVersion)
-	pc.Run(wait.NeverStop)
+	if !leaderElectionConfig.Enabled {
+		logger.Printf("Leader election is disabled, running as the only provisioner")
+		run(wait.NeverStop)
+		return
+	}
+	runWithLeaderElection(logger, clientset, leaderElectionConfig, run)
+}
+
+func serveMetrics(logger *log.Logger, address string) {
+	http.Handle("/metrics", promhttp.Handler())
+	logger.Printf("Serving metrics on %s/metrics", address)
+	if err := http.ListenAndServe(address, nil); err != nil {
+		logger.Printf("Failed to serve metrics: %v", err)
+	}
+}
+
+// runWithLeaderElection runs the controllers only while this replica is the leader, the other replicas are standby.
+func runWithLeaderElection(logger *log.Logger, clientset kubernetes.Interface, leaderElectionConfig k8sutils.LeaderElectionConfig, run func(stopCh <-chan struct{})) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to get hostname: %v", err))
+	}
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events(leaderElectionConfig.Namespace)})
+	eventRecorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: k8sresources.UbiquityProvisionerName})
+
+	lock := &resourcelock.ConfigMapLock{
+		ConfigMapMeta: metav1.ObjectMeta{Namespace: leaderElectionConfig.Namespace, Name: leaderElectionConfig.LockName},
+		Client:        clientset.CoreV1(),
+		LockConfig:    resourcelock.ResourceLockConfig{Identity: identity, EventRecorder: eventRecorder},
+	}
+	logger.Printf("Starting leader election %#v, identity %s", leaderElectionConfig, identity)
+	leaderelection.RunOrDie(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaderElectionConfig.LeaseDuration,
+		RenewDeadline: leaderElectionConfig.RenewDeadline,
+		RetryPeriod:   leaderElectionConfig.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stopCh <-chan struct{}) {
+				logger.Printf("Became the leader %s", identity)
+				run(stopCh)
+			},
+			OnStoppedLeading: func() {
+				// Exit so the pod restarts as a standby, the controllers must not keep running without the lease.
+				panic(fmt.Sprintf("Lost the leader election %s", identity))
+			},
+			OnNewLeader: func(leader string) {
+				logger.Printf("The leader is %s", leader)
+			},
+		},
+	})
 }
@@ -0,0 +1,76 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
+)
+
+//BackendHandler holds the backend specific behaviour of the flex driver.
+//Each ubiquity backend (e.g scbe, spectrum-scale) has its own handler, registered by the backend name.
+type BackendHandler interface {
+	// Name returns the ubiquity backend name the handler is registered with.
+	Name() string
+
+	// GetMountpointForMount returns the node mountpoint in which the volume should be mounted.
+	GetMountpointForMount(mountRequest k8sresources.FlexVolumeMountRequest, volumeConfig map[string]interface{}) (string, error)
+
+	// GetRealMountpoint returns the node mountpoint of an already mounted volume.
+	GetRealMountpoint(volumeConfig map[string]interface{}) (string, error)
+
+	// IsAttachSupported returns false if the backend volumes are always attached to all the nodes,
+	// so the flex attach, waitforattach, isattached and detach APIs are not relevant for it.
+	IsAttachSupported() bool
+
+	// IsMountOptionsSupported returns true if the global mountpoint of the backend volumes is a real mount,
+	// so the k8s mountOptions can be applied on it by a remount.
+	IsMountOptionsSupported() bool
+
+	// DetachAfterUnmount returns true if the volume should be detached from the node right after its last unmount (legacy detach).
+	DetachAfterUnmount() bool
+}
+
+var (
+	backendHandlers     = make(map[string]BackendHandler)
+	backendHandlersLock sync.RWMutex
+)
+
+//RegisterBackendHandler makes a backend handler available for the volumes of its backend.
+//It panics if a handler with the same name is already registered.
+func RegisterBackendHandler(handler BackendHandler) {
+	backendHandlersLock.Lock()
+	defer backendHandlersLock.Unlock()
+
+	if _, exist := backendHandlers[handler.Name()]; exist {
+		panic(fmt.Sprintf("backend handler [%s] is already registered", handler.Name()))
+	}
+	backendHandlers[handler.Name()] = handler
+}
+
+func getBackendHandler(backend string) (BackendHandler, error) {
+	backendHandlersLock.RLock()
+	defer backendHandlersLock.RUnlock()
+
+	handler, ok := backendHandlers[backend]
+	if !ok {
+		return nil, &PvBackendNotSupportedError{Backend: backend}
+	}
+	return handler, nil
+}
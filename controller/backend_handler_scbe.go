@@ -0,0 +1,63 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"fmt"
+
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
+	"github.com/IBM/ubiquity/resources"
+)
+
+// scbeBackendHandler handles block volumes, which are mounted by WWN and attached to a single node at a time.
+type scbeBackendHandler struct{}
+
+func init() {
+	RegisterBackendHandler(&scbeBackendHandler{})
+}
+
+func (h *scbeBackendHandler) Name() string {
+	return resources.SCBE
+}
+
+func (h *scbeBackendHandler) GetMountpointForMount(mountRequest k8sresources.FlexVolumeMountRequest, volumeConfig map[string]interface{}) (string, error) {
+	wwn, ok := mountRequest.Opts["Wwn"]
+	if !ok {
+		return "", fmt.Errorf(MissingWwnMountRequestErrorStr)
+	}
+	return fmt.Sprintf(resources.PathToMountUbiquityBlockDevices, wwn), nil
+}
+
+func (h *scbeBackendHandler) GetRealMountpoint(volumeConfig map[string]interface{}) (string, error) {
+	wwn, ok := volumeConfig["Wwn"].(string)
+	if !ok {
+		return "", fmt.Errorf(MissingWwnMountRequestErrorStr)
+	}
+	return fmt.Sprintf(resources.PathToMountUbiquityBlockDevices, wwn), nil
+}
+
+func (h *scbeBackendHandler) IsAttachSupported() bool {
+	return true
+}
+
+func (h *scbeBackendHandler) IsMountOptionsSupported() bool {
+	return true
+}
+
+func (h *scbeBackendHandler) DetachAfterUnmount() bool {
+	return true
+}
@@ -0,0 +1,63 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
+	"github.com/IBM/ubiquity/resources"
+)
+
+// spectrumScaleBackendHandler handles filesets, which are always available on all the nodes of the cluster.
+type spectrumScaleBackendHandler struct{}
+
+func init() {
+	RegisterBackendHandler(&spectrumScaleBackendHandler{})
+}
+
+func (h *spectrumScaleBackendHandler) Name() string {
+	return resources.SpectrumScale
+}
+
+func (h *spectrumScaleBackendHandler) GetMountpointForMount(mountRequest k8sresources.FlexVolumeMountRequest, volumeConfig map[string]interface{}) (string, error) {
+	mountpoint, ok := volumeConfig["mountpoint"].(string)
+	if !ok {
+		return "", &SpectrumScaleMissingMntPtVolumeError{VolumeName: mountRequest.MountDevice}
+	}
+	return mountpoint, nil
+}
+
+func (h *spectrumScaleBackendHandler) GetRealMountpoint(volumeConfig map[string]interface{}) (string, error) {
+	//TODO: scale should remove the mountpoint
+	mountpoint, ok := volumeConfig["mountpoint"].(string)
+	if !ok {
+		return "", &SpectrumScaleMissingMntPtVolumeError{}
+	}
+	return mountpoint, nil
+}
+
+func (h *spectrumScaleBackendHandler) IsAttachSupported() bool {
+	return false
+}
+
+func (h *spectrumScaleBackendHandler) IsMountOptionsSupported() bool {
+	// The fileset is a directory of the filesystem that is mounted by Spectrum Scale, not a mount of its own.
+	return false
+}
+
+func (h *spectrumScaleBackendHandler) DetachAfterUnmount() bool {
+	return false
+}
@@ -22,7 +22,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	k8sresources "github.com/IBM/ubiquity-k8s/resources"
@@ -32,6 +34,8 @@ import (
 	"github.com/IBM/ubiquity/utils"
 	"github.com/IBM/ubiquity/utils/logs"
 	"github.com/nightlyone/lockfile"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 )
  
 const(
@@ -40,51 +44,85 @@ const(
 	FlexSuccessStr = "Success"
 	FlexFailureStr = "Failure"
 	FlexNotSupportedStr = "Not supported"
+
+	// kubelet exposes the global mount of the volume (attach/detach flow) under this directory, relative to the kubelet root directory.
+	k8sDeviceMountDirectoryName = "plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts"
+
+	// udev creates this link for every multipath device, the suffix is "3" followed by the lower case WWN of the volume.
+	multipathDeviceByIdPathTemplate = "/dev/disk/by-id/dm-uuid-mpath-3%s"
+	defaultWaitForAttachTimeout     = 60 * time.Second
+	defaultWaitForAttachInterval    = 2 * time.Second
+
+	// kubelet gives up on a flex call after about 2 minutes, so waiting for a flock must end well before that,
+	// leaving the rest of the budget to the operation itself.
+	flexCallBudget       = 2 * time.Minute
+	defaultFlockTimeout  = flexCallBudget / 2
+	defaultFlockInterval = 500 * time.Millisecond
 )
 
+var rescanScsiCommands = []string{"rescan-scsi-bus", "rescan-scsi-bus.sh"}
+
 //Controller this is a structure that controls volume management
 type Controller struct {
-	Client            resources.StorageClient
-	exec              utils.Executor
-	logger            logs.Logger
-	legacyLogger      *log.Logger
-	config            resources.UbiquityPluginConfig
-	mounterPerBackend map[string]resources.Mounter
-	unmountFlock      lockfile.Lockfile
-	mounterFactory    mounter.MounterFactory
+	Client                resources.StorageClient
+	exec                  utils.Executor
+	logger                logs.Logger
+	legacyLogger          *log.Logger
+	config                resources.UbiquityPluginConfig
+	mounterPerBackend     map[string]resources.Mounter
+	mounterFactory        mounter.MounterFactory
+	waitForAttachTimeout  time.Duration
+	waitForAttachInterval time.Duration
+	volumeMetadataStore   *volumeMetadataStore
+	flockTimeout          time.Duration
+	flockInterval         time.Duration
+	flexConfig            k8sresources.UbiquityK8sFlexConfig
+	kubeClient            kubernetes.Interface
 }
 
-func newController(logger *log.Logger, config resources.UbiquityPluginConfig, client resources.StorageClient, exec utils.Executor, mFactory mounter.MounterFactory) (*Controller, error) {
-	unmountFlock, err := lockfile.New(filepath.Join(os.TempDir(), "ubiquity.unmount.lock"))
-	if err != nil {
-		panic(err)
-	}
-
+func newController(logger *log.Logger, config resources.UbiquityPluginConfig, flexConfig k8sresources.UbiquityK8sFlexConfig, client resources.StorageClient, exec utils.Executor, mFactory mounter.MounterFactory, volumeMetadataDir string) (*Controller, error) {
 	return &Controller{
-		logger:            logs.GetLogger(),
-		legacyLogger:      logger,
-		Client:            client,
-		exec:              exec,
-		config:            config,
-		mounterPerBackend: make(map[string]resources.Mounter),
-		unmountFlock:      unmountFlock,
-		mounterFactory:    mFactory,
+		logger:                logs.GetLogger(),
+		legacyLogger:          logger,
+		Client:                client,
+		exec:                  exec,
+		config:                config,
+		mounterPerBackend:     make(map[string]resources.Mounter),
+		mounterFactory:        mFactory,
+		waitForAttachTimeout:  defaultWaitForAttachTimeout,
+		waitForAttachInterval: defaultWaitForAttachInterval,
+		volumeMetadataStore:   newVolumeMetadataStore(volumeMetadataDir),
+		flockTimeout:          defaultFlockTimeout,
+		flockInterval:         defaultFlockInterval,
+		flexConfig:            flexConfig,
 	}, nil
 }
 
 //NewController allows to instantiate a controller
-func NewController(logger *log.Logger, config resources.UbiquityPluginConfig) (*Controller, error) {
+func NewController(logger *log.Logger, config resources.UbiquityPluginConfig, flexConfig k8sresources.UbiquityK8sFlexConfig) (*Controller, error) {
 	remoteClient, err := remote.NewRemoteClientSecure(logger, config)
 	if err != nil {
 		return nil, err
 	}
 	
-	return newController(logger, config, remoteClient, utils.NewExecutor(), mounter.NewMounterFactory())
+	controller, err := newController(logger, config, flexConfig, remoteClient, utils.NewExecutor(), mounter.NewMounterFactory(), defaultVolumeMetadataDir)
+	if err != nil {
+		return nil, err
+	}
+	if flexConfig.KubeConfig != "" {
+		// The events are best effort, so the flex works without them if the kubeconfig is not usable.
+		if kubeConfig, err := clientcmd.BuildConfigFromFlags("", flexConfig.KubeConfig); err != nil {
+			controller.logger.Warning("Failed to load the kubeconfig, events will not be recorded", logs.Args{{"kubeconfig", flexConfig.KubeConfig}, {"error", err}})
+		} else if controller.kubeClient, err = kubernetes.NewForConfig(kubeConfig); err != nil {
+			controller.logger.Warning("Failed to create the kubernetes client, events will not be recorded", logs.Args{{"kubeconfig", flexConfig.KubeConfig}, {"error", err}})
+		}
+	}
+	return controller, nil
 }
 
 //NewControllerWithClient is made for unit testing purposes where we can pass a fake client
-func NewControllerWithClient(logger *log.Logger, config resources.UbiquityPluginConfig, client resources.StorageClient, exec utils.Executor, mFactory mounter.MounterFactory) *Controller {
-	controller, _ :=  newController(logger, config, client, exec, mFactory)
+func NewControllerWithClient(logger *log.Logger, config resources.UbiquityPluginConfig, client resources.StorageClient, exec utils.Executor, mFactory mounter.MounterFactory, volumeMetadataDir string) *Controller {
+	controller, _ := newController(logger, config, k8sresources.UbiquityK8sFlexConfig{}, client, exec, mFactory, volumeMetadataDir)
 	return controller
 }
 
@@ -140,8 +178,12 @@ func (c *Controller) Attach(attachRequest k8sresources.FlexVolumeAttachRequest)
 	}
 
 	//TODO: later we should consider to get the volume backend by using the attachRequest.opts instead of calling to ubiquity server
-	if (volume.Backend == resources.SpectrumScale) {
-		response = c.notSupportedFlexVolumeResponse("Flex Attach API is not supported for spectrum-scale backend, because the backend assume that volume is already attached to all nodes")
+	backendHandler, err := getBackendHandler(volume.Backend)
+	if err != nil {
+		return c.failureFlexVolumeResponse(c.logger.ErrorRet(err, "failed"), "")
+	}
+	if !backendHandler.IsAttachSupported() {
+		response = c.notSupportedFlexVolumeResponse(fmt.Sprintf("Flex Attach API is not supported for %s backend, because the backend assume that volume is already attached to all nodes", volume.Backend))
 		return response
 	}
 
@@ -149,6 +191,8 @@ func (c *Controller) Attach(attachRequest k8sresources.FlexVolumeAttachRequest)
 	if err != nil {
 		msg := fmt.Sprintf("Failed to attach volume [%s]", attachRequest.Name)
 		response = c.failureFlexVolumeResponse(err, msg)
+		// The attach is not done for a specific pod, so its failure is recorded on the PV.
+		c.recordPVEvent(attachRequest.Name, ReasonAttachFailed, response.Message)
 	} else {
 		response = c.successFlexVolumeResponse("")
 	}
@@ -157,14 +201,31 @@ func (c *Controller) Attach(attachRequest k8sresources.FlexVolumeAttachRequest)
 	return response
 }
 
-//GetVolumeName checks if volume is attached
+//GetVolumeName returns the unique volume name (the PV name) that kubernetes uses to address the volume in the attach/detach flows
 func (c *Controller) GetVolumeName(getVolumeNameRequest k8sresources.FlexVolumeGetVolumeNameRequest) k8sresources.FlexVolumeResponse {
+	go_id := logs.GetGoID()
+	logs.GoIdToRequestIdMap.Store(go_id, getVolumeNameRequest.Context)
+	defer logs.GetDeleteFromMapFunc(go_id)
 	defer c.logger.Trace(logs.DEBUG)()
 	var response k8sresources.FlexVolumeResponse
 	c.logger.Debug("", logs.Args{{"request", getVolumeNameRequest}})
 
+	// The provisioner sets the volumeName option in the PV flex options (see createVolume), so its the same name for all the nodes in the cluster.
+	volName, ok := getVolumeNameRequest.Opts["volumeName"]
+	if !ok || volName == "" {
+		err := fmt.Errorf("volumeName not found in getVolumeNameRequest")
+		return c.failureFlexVolumeResponse(err, "")
+	}
+
+	getVolumeRequest := resources.GetVolumeRequest{Name: volName, Context: getVolumeNameRequest.Context}
+	if _, err := c.Client.GetVolume(getVolumeRequest); err != nil {
+		errormsg := fmt.Sprintf("Failed to get Volume details [%s]", volName)
+		return c.failureFlexVolumeResponse(err, errormsg)
+	}
+
 	response = k8sresources.FlexVolumeResponse{
-		Status: "Not supported",
+		Status:     FlexSuccessStr,
+		VolumeName: volName,
 	}
 
 	c.logger.Debug("", logs.Args{{"response", response}})
@@ -180,8 +241,36 @@ func (c *Controller) WaitForAttach(waitForAttachRequest k8sresources.FlexVolumeW
 	var response k8sresources.FlexVolumeResponse
 	c.logger.Debug("", logs.Args{{"request", waitForAttachRequest}})
 
-	response = k8sresources.FlexVolumeResponse{
-		Status: "Not supported",
+	volName, ok := waitForAttachRequest.Opts["volumeName"]
+	if !ok {
+		err := fmt.Errorf("volumeName not found in waitForAttachRequest")
+		return c.failureFlexVolumeResponse(err, "")
+	}
+
+	getVolumeRequest := resources.GetVolumeRequest{Name: volName, Context: waitForAttachRequest.Context}
+	volume, err := c.Client.GetVolume(getVolumeRequest)
+	if err != nil {
+		errormsg := fmt.Sprintf("Failed to get Volume details [%s]", volName)
+		return c.failureFlexVolumeResponse(err, errormsg)
+	}
+
+	backendHandler, err := getBackendHandler(volume.Backend)
+	if err != nil {
+		return c.failureFlexVolumeResponse(c.logger.ErrorRet(err, "failed"), "")
+	}
+	if !backendHandler.IsAttachSupported() {
+		return c.notSupportedFlexVolumeResponse(fmt.Sprintf("Flex WaitForAttach API is not supported for %s backend, because the backend assume that volume is already attached to all nodes", volume.Backend))
+	}
+
+	devicePath, err := c.doWaitForAttach(waitForAttachRequest, volName)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to wait for attach of volume [%s]. ", volName)
+		response = c.failureFlexVolumeResponse(err, msg)
+	} else {
+		response = k8sresources.FlexVolumeResponse{
+			Status: FlexSuccessStr,
+			Device: devicePath,
+		}
 	}
 
 	c.logger.Debug("", logs.Args{{"response", response}})
@@ -207,8 +296,8 @@ func (c *Controller) IsAttached(isAttachedRequest k8sresources.FlexVolumeIsAttac
 		return response
 	}
 
-	getVolumeRequest := resources.GetVolumeRequest{Name: volName}
-	if volume, err = c.Client.GetVolume(getVolumeRequest); err != nil {
+	var metadata *volumeMetadata
+	if volume, metadata, err = c.getVolumeWithFallback(volName, isAttachedRequest.Context); err != nil {
 		if strings.Contains(err.Error(), resources.VolumeNotFoundErrorMsg) {
 			warningMsg := fmt.Sprintf("%s (backend error=%v)", IdempotentIsAttachedSkipOnVolumeNotExistWarnigMsg, err)
 			c.logger.Warning(warningMsg)
@@ -222,8 +311,27 @@ func (c *Controller) IsAttached(isAttachedRequest k8sresources.FlexVolumeIsAttac
 		return c.failureFlexVolumeResponse(err, "")
 	}
 
-	if (volume.Backend == resources.SpectrumScale) {
-		response = c.notSupportedFlexVolumeResponse("Flex IsAttached API is not supported for spectrum-scale backend, because the backend assume that volume is always attached")
+	backendHandler, err := getBackendHandler(volume.Backend)
+	if err != nil {
+		return c.failureFlexVolumeResponse(c.logger.ErrorRet(err, "failed"), "")
+	}
+	if !backendHandler.IsAttachSupported() {
+		response = c.notSupportedFlexVolumeResponse(fmt.Sprintf("Flex IsAttached API is not supported for %s backend, because the backend assume that volume is always attached", volume.Backend))
+		return response
+	}
+
+	if metadata != nil {
+		// ubiquity is not reachable, so answer by the volume config that was saved on the node
+		attachTo, err := c.getHostAttachUsingConfig(metadata.VolumeConfig)
+		if err != nil {
+			return c.failureFlexVolumeResponse(err, fmt.Sprintf("Failed to check IsAttached volume [%s]", volName))
+		}
+		response = k8sresources.FlexVolumeResponse{
+			Status:   "Success",
+			Attached: isAttachedRequest.Host == attachTo,
+			Message:  VolumeMetadataFallbackWarningMsg,
+		}
+		c.logger.Debug("", logs.Args{{"response", response}})
 		return response
 	}
 
@@ -269,8 +377,12 @@ func (c *Controller) Detach(detachRequest k8sresources.FlexVolumeDetachRequest)
 	        return c.failureFlexVolumeResponse(err, "")
 	    }
 
-		if (volume.Backend == resources.SpectrumScale) {
-			response = c.notSupportedFlexVolumeResponse("Flex Detach API is not supported for spectrum-scale backend, because the backend assume that volume is always remain attached")
+		backendHandler, err := getBackendHandler(volume.Backend)
+		if err != nil {
+			return c.failureFlexVolumeResponse(c.logger.ErrorRet(err, "failed"), "")
+		}
+		if !backendHandler.IsAttachSupported() {
+			response = c.notSupportedFlexVolumeResponse(fmt.Sprintf("Flex Detach API is not supported for %s backend, because the backend assume that volume is always remain attached", volume.Backend))
 			return response
 		}
 
@@ -293,7 +405,7 @@ func (c *Controller) Detach(detachRequest k8sresources.FlexVolumeDetachRequest)
 	return response
 }
 
-//MountDevice mounts a device in a given location
+//MountDevice mounts the volume once per node (the global mount) and exposes it in the device mount path given by kubelet
 func (c *Controller) MountDevice(mountDeviceRequest k8sresources.FlexVolumeMountDeviceRequest) k8sresources.FlexVolumeResponse {
 	go_id := logs.GetGoID()
 	logs.GoIdToRequestIdMap.Store(go_id, mountDeviceRequest.Context)
@@ -302,58 +414,115 @@ func (c *Controller) MountDevice(mountDeviceRequest k8sresources.FlexVolumeMount
 	var response k8sresources.FlexVolumeResponse
 	c.logger.Debug("", logs.Args{{"request", mountDeviceRequest}})
 
-	response = k8sresources.FlexVolumeResponse{
-		Status: "Not supported",
+	volName, ok := mountDeviceRequest.Opts["volumeName"]
+	if !ok {
+		err := fmt.Errorf("volumeName not found in mountDeviceRequest")
+		return c.failureFlexVolumeResponse(err, "")
+	}
+
+	volumeFlock, err := c.lockVolumeFlock(volName)
+	if err != nil {
+		return c.failureFlexVolumeResponse(err, "")
+	}
+	defer volumeFlock.Unlock()
+
+	mountRequest := k8sresources.FlexVolumeMountRequest{
+		MountPath:   mountDeviceRequest.Path,
+		MountDevice: volName,
+		Opts:        mountDeviceRequest.Opts,
+		Version:     k8sresources.KubernetesVersion_1_6OrLater,
+		Context:     mountDeviceRequest.Context,
+	}
+	mountedPath, err := c.doMount(mountRequest)
+	if err != nil {
+		response = c.failureFlexVolumeResponse(err, "")
+	} else if err = c.doAfterMount(mountRequest, mountedPath); err != nil {
+		// The volume stays attached, since kubelet detaches it through the flex detach API.
+		response = c.failureFlexVolumeResponse(err, c.rollbackMount(mountRequest, mountedPath, false))
+	} else {
+		response = c.successFlexVolumeResponse("")
 	}
 
 	c.logger.Debug("", logs.Args{{"response", response}})
 	return response
 }
 
-//UnmountDevice checks if volume is unmounted
+//UnmountDevice removes the device mount path given by kubelet and unmounts the global mount of the volume
 func (c *Controller) UnmountDevice(unmountDeviceRequest k8sresources.FlexVolumeUnmountDeviceRequest) k8sresources.FlexVolumeResponse {
 	go_id := logs.GetGoID()
 	logs.GoIdToRequestIdMap.Store(go_id, unmountDeviceRequest.Context)
 	defer logs.GetDeleteFromMapFunc(go_id)
 	defer c.logger.Trace(logs.DEBUG)()
-	var response k8sresources.FlexVolumeResponse
 	c.logger.Debug("", logs.Args{{"request", unmountDeviceRequest}})
+	deviceMountPath := unmountDeviceRequest.Name
 
-	response = k8sresources.FlexVolumeResponse{
-		Status: "Not supported",
+	pvName := path.Base(deviceMountPath) // kubelet device mount path ends with the pv name, same as the k8s PV directory.
+	volumeFlock, err := c.lockVolumeFlock(pvName)
+	if err != nil {
+		return c.failureFlexVolumeResponse(err, "")
 	}
+	defer volumeFlock.Unlock()
 
-	c.logger.Debug("", logs.Args{{"response", response}})
-	return response
+	var mounter resources.Mounter
+	var volumeConfig map[string]interface{}
+	var volume resources.Volume
+
+	var metadata *volumeMetadata
+	if volume, metadata, err = c.getVolumeWithFallback(pvName, unmountDeviceRequest.Context); err != nil {
+		if strings.Contains(err.Error(), resources.VolumeNotFoundErrorMsg) {
+			warningMsg := fmt.Sprintf("%s (backend error=%v)", IdempotentUnmountDeviceSkipOnVolumeNotExistWarnigMsg, err)
+			c.logger.Warning(warningMsg)
+			return c.successFlexVolumeResponse(warningMsg)
+		}
+		return c.failureFlexVolumeResponse(err, "")
+	}
+	if metadata == nil {
+		c.reconcileVolumeMetadata(pvName, unmountDeviceRequest.Context)
+	}
+
+	if mounter, err = c.getMounterForBackend(volume.Backend, unmountDeviceRequest.Context); err != nil {
+		return c.failureFlexVolumeResponse(err, "Error determining mounter for volume. ")
+	}
+
+	if volumeConfig, metadata, err = c.getVolumeConfigWithFallback(pvName, unmountDeviceRequest.Context, metadata); err != nil {
+		return c.failureFlexVolumeResponse(err, "Error unmount device for volume. ")
+	}
+
+	isUnmounted, err := c.doUnmount(deviceMountPath, volume.Backend, volumeConfig, mounter)
+	if err != nil {
+		return c.failureFlexVolumeResponse(err, "")
+	}
+	if isUnmounted {
+		// The detach is done by the attach/detach controller, so there is nothing left to do with the volume on this node.
+		c.deleteVolumeMetadata(pvName)
+	}
+
+	if metadata != nil {
+		return c.successFlexVolumeResponse(VolumeMetadataFallbackWarningMsg)
+	}
+	return c.successFlexVolumeResponse("")
 }
 
 
 //Mount method allows to mount the volume/fileset to a given location for a pod
-func (c *Controller) Mount(mountRequest k8sresources.FlexVolumeMountRequest) k8sresources.FlexVolumeResponse {
+func (c *Controller) Mount(mountRequest k8sresources.FlexVolumeMountRequest) (response k8sresources.FlexVolumeResponse) {
 	go_id := logs.GetGoID()
 	logs.GoIdToRequestIdMap.Store(go_id, mountRequest.Context)
 	defer logs.GetDeleteFromMapFunc(go_id)
 	defer c.logger.Trace(logs.DEBUG)()
-	var response k8sresources.FlexVolumeResponse
 	c.logger.Debug("", logs.Args{{"request", mountRequest}})
-	
-	flockName := fmt.Sprintf("ubiquity.mount.%s.lock", mountRequest.MountDevice)
-	mountFlock, err := lockfile.New(filepath.Join(os.TempDir(), flockName ))
+	defer func() {
+		if response.Status == FlexFailureStr {
+			c.recordPodEvent(mountRequest.Opts[k8sresources.OptionNameForPodNamespace], mountRequest.Opts[k8sresources.OptionNameForPodName], mountRequest.Opts[k8sresources.OptionNameForPodUID], ReasonMountFailed, response.Message)
+		}
+	}()
+
+	volumeFlock, err := c.lockVolumeFlock(mountRequest.MountDevice)
 	if err != nil {
-		panic(err)
+		return c.failureFlexVolumeResponse(err, "")
 	}
+	defer volumeFlock.Unlock()
 
-	for {
-		err := mountFlock.TryLock()
-		if err == nil {
-			break
-		}
-		c.logger.Debug("mountFlock.TryLock failed", logs.Args{{"error", err}})
-		time.Sleep(time.Duration(500 * time.Millisecond))
-	}
-	c.logger.Debug("Got mountFlock for volume.", logs.Args{{"volume", mountRequest.MountDevice}})
-	defer mountFlock.Unlock()
-	
 	// TODO check if volume exist first and what its backend type
 	mountedPath, err := c.doMount(mountRequest)
 	if err != nil {
@@ -361,7 +530,7 @@ func (c *Controller) Mount(mountRequest k8sresources.FlexVolumeMountRequest) k8s
 	} else {
 		err = c.doAfterMount(mountRequest, mountedPath)
 		if err != nil {
-			response = c.failureFlexVolumeResponse(err, "")
+			response = c.failureFlexVolumeResponse(err, c.rollbackMount(mountRequest, mountedPath, true))
 		} else {
 			response = k8sresources.FlexVolumeResponse{
 				Status: "Success",
@@ -373,6 +542,125 @@ func (c *Controller) Mount(mountRequest k8sresources.FlexVolumeMountRequest) k8s
 	return response
 }
 
+func (c *Controller) rollbackMount(mountRequest k8sresources.FlexVolumeMountRequest, mountedPath string, legacyDetach bool) string {
+	/*
+		Undo a mount whose k8s mountpoint could not be prepared, so the node is left as it was before the call.
+		The volume mountpoint is unmounted (and the volume detached in the legacy flow) only if no other pod uses it.
+		Returns the rollback result as a prefix for the failure message of the response.
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+
+	if err := c.doRollbackMount(mountRequest, mountedPath, legacyDetach); err != nil {
+		c.logger.Error("Failed to roll back the mount", logs.Args{{"volume", mountRequest.MountDevice}, {"error", err}})
+		return fmt.Sprintf(MountRollbackFailedMsg, err)
+	}
+	c.logger.Info("Rolled back the mount", logs.Args{{"volume", mountRequest.MountDevice}})
+	return MountRollbackSucceededMsg
+}
+
+func (c *Controller) doRollbackMount(mountRequest k8sresources.FlexVolumeMountRequest, mountedPath string, legacyDetach bool) error {
+	defer c.logger.Trace(logs.DEBUG)()
+
+	users, err := getMountPointUsers(mountedPath, mountRequest.MountPath, c.logger, c.exec)
+	if err != nil {
+		return c.logger.ErrorRet(err, "getMountPointUsers failed")
+	}
+	if len(users) > 0 {
+		c.logger.Info("The mountpoint is still in use on this node. Skip unmount of the mountpoint.", logs.Args{{"mountpoint", mountedPath}, {"users", users}})
+		return nil
+	}
+
+	volume, metadata, err := c.getVolumeWithFallback(mountRequest.MountDevice, mountRequest.Context)
+	if err != nil {
+		return c.logger.ErrorRet(err, "getVolumeWithFallback failed")
+	}
+	mounter, err := c.getMounterForBackend(volume.Backend, mountRequest.Context)
+	if err != nil {
+		return c.logger.ErrorRet(err, "getMounterForBackend failed")
+	}
+	volumeConfig, _, err := c.getVolumeConfigWithFallback(mountRequest.MountDevice, mountRequest.Context, metadata)
+	if err != nil {
+		return c.logger.ErrorRet(err, "getVolumeConfigWithFallback failed")
+	}
+
+	rescanFlock, err := c.lockRescanFlock()
+	if err != nil {
+		return c.logger.ErrorRet(err, "lockRescanFlock failed")
+	}
+	err = mounter.Unmount(resources.UnmountRequest{VolumeConfig: volumeConfig})
+	rescanFlock.Unlock()
+	if err != nil {
+		return c.logger.ErrorRet(err, "mounter.Unmount failed")
+	}
+
+	if legacyDetach {
+		handler, err := getBackendHandler(volume.Backend)
+		if err == nil && handler.DetachAfterUnmount() {
+			unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountRequest.MountDevice, Context: mountRequest.Context}
+			if err := c.doLegacyDetach(unmountRequest); err != nil {
+				return c.logger.ErrorRet(err, "doLegacyDetach failed")
+			}
+		}
+	}
+
+	c.deleteVolumeMetadata(mountRequest.MountDevice)
+	return nil
+}
+
+func (c *Controller) lockVolumeFlock(volumeName string) (lockfile.Lockfile, error) {
+	// Serialize the mount and unmount flows of the same volume on the node, flows of different volumes run in parallel.
+	defer c.logger.Trace(logs.DEBUG)()
+	return c.lockFlock(volumeFlockName(volumeName))
+}
+
+func (c *Controller) tryLockVolumeFlock(volumeName string) (lockfile.Lockfile, error) {
+	// Take the volume flock only if it is free, so a flow that already holds the flock of its own volume never waits for another volume.
+	defer c.logger.Trace(logs.DEBUG)()
+	flock, err := lockfile.New(filepath.Join(os.TempDir(), volumeFlockName(volumeName)))
+	if err != nil {
+		return flock, c.logger.ErrorRet(err, "lockfile.New failed", logs.Args{{"volume", volumeName}})
+	}
+	return flock, flock.TryLock()
+}
+
+func volumeFlockName(volumeName string) string {
+	return fmt.Sprintf("ubiquity.volume.%s.lock", volumeName)
+}
+
+func (c *Controller) lockRescanFlock() (lockfile.Lockfile, error) {
+	// locking for concurrent rescans and device cleanups, since they work on all the devices of the node.
+	defer c.logger.Trace(logs.DEBUG)()
+	return c.lockFlock("ubiquity.rescan.lock")
+}
+
+func (c *Controller) lockFlock(flockName string) (lockfile.Lockfile, error) {
+	flock, err := lockfile.New(filepath.Join(os.TempDir(), flockName))
+	if err != nil {
+		return flock, c.logger.ErrorRet(err, "lockfile.New failed", logs.Args{{"flock", flockName}})
+	}
+
+	c.logger.Debug("Ask for flock", logs.Args{{"flock", flockName}})
+	deadline := time.Now().Add(c.flockTimeout)
+	for {
+		err := flock.TryLock()
+		if err == nil {
+			break
+		}
+		// TryLock reclaims the flock of a dead owner by itself, so just retry until the deadline.
+		c.logger.Debug("flock.TryLock failed", logs.Args{{"flock", flockName}, {"error", err}})
+		if !time.Now().Before(deadline) {
+			ownerPid := -1
+			if owner, ownerErr := flock.GetOwner(); ownerErr == nil && owner != nil {
+				ownerPid = owner.Pid
+			}
+			return flock, c.logger.ErrorRet(&FlockTimeoutError{Flock: string(flock), OwnerPid: ownerPid, Timeout: c.flockTimeout}, "failed")
+		}
+		time.Sleep(c.flockInterval)
+	}
+	c.logger.Debug("Got flock", logs.Args{{"flock", flockName}})
+	return flock, nil
+}
+
 func (c *Controller) successFlexVolumeResponse(msg string) k8sresources.FlexVolumeResponse {
 	defer c.logger.Trace(logs.DEBUG)()
 	response := k8sresources.FlexVolumeResponse{
@@ -404,13 +692,41 @@ func (c *Controller) notSupportedFlexVolumeResponse(msg string) k8sresources.Fle
 	return response
 }
 
-func (c *Controller) checkSlinkBeforeUmount(k8sPVDirectoryPath string, realMountedPath string) (bool, error) {
+func (c *Controller) checkSlinkBeforeRemove(k8sPVDirectoryPath string, realMountedPath string) error {
 	/*
-	   Return <isSlink, error>
-	   true,  nil   : slink exist as expected
-	   false, nil   : slink not exist, which indicate for idempotent issue
-	   true,  error : its slink but error during evaluate it or its slink but not to the right place
-	   false, error : its something different then slink
+		The k8s PV directory is a slink that was created by older versions of the flex (before the bind mount model).
+		Return error if the slink point to wrong mountpoint, dangling slink is ok (idempotent).
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+
+	evalSlink, err := c.exec.EvalSymlinks(k8sPVDirectoryPath)
+	if err != nil {
+		message := "Controller: Idempotent - failed to eval the slink of the PV directory(k8s-mountpoint)"
+		if os.IsNotExist(err) {
+			c.logger.Warning(message, logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"error", err}})
+			return nil
+		}
+		return c.logger.ErrorRet(err, message, logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+	}
+	if evalSlink != realMountedPath {
+		// Very edge case, where the slink is point to wrong mountpoint
+		return c.logger.ErrorRet(
+			&wrongSlinkError{slink: k8sPVDirectoryPath, wrongPointTo: evalSlink, expectedPointTo: realMountedPath},
+			"failed")
+	}
+	c.logger.Info("PV directory(k8s-mountpoint) is slink that point to the right mountpoint.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", realMountedPath}})
+	return nil
+}
+
+func (c *Controller) removeK8sPVDirectory(k8sPVDirectoryPath string, realMountedPath string) error {
+	/*
+		Unmount the bind mount of the global mountpoint from the k8s PV directory and then remove the directory.
+		Idempotent:
+			1. if k8s PV dir not exist, skip.
+			2. if k8s PV dir is a slink (created by older flex versions) that point to the right mountpoint, remove the slink.
+			3. if k8s PV dir is a mounted directory, unmount it and remove it.
+			4. if k8s PV dir is a directory that is not mounted, just remove it.
+			5. else raise error.
 	*/
 	defer c.logger.Trace(logs.DEBUG)()
 
@@ -419,117 +735,116 @@ func (c *Controller) checkSlinkBeforeUmount(k8sPVDirectoryPath string, realMount
 	if err != nil {
 		if c.exec.IsNotExist(err) {
 			// The k8s PV directory not exist (its a rare case and indicate on idempotent flow)
-			c.logger.Warning("PV directory(k8s-mountpoint) does not exist.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"should-point-to-mountpoint", realMountedPath}}) 
-			return false, nil                                                                                                                                                 // Idempotent flow
-		} else {
-			// Maybe some permissions issue
-			return false, c.logger.ErrorRet(err, "Controller: failed to identify PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+			c.logger.Warning("PV directory(k8s-mountpoint) does not exist. Idempotent - skip unbind.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", realMountedPath}})
+			return nil
 		}
-	} else if c.exec.IsSlink(fileInfo) {
-		// Its already slink so check if slink is ok and skip else raise error
-		evalSlink, err := c.exec.EvalSymlinks(k8sPVDirectoryPath)
+		// Maybe some permissions issue
+		return c.logger.ErrorRet(err, "Controller: failed to identify PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+	}
+
+	if c.exec.IsSlink(fileInfo) {
+		if err := c.checkSlinkBeforeRemove(k8sPVDirectoryPath, realMountedPath); err != nil {
+			return c.logger.ErrorRet(err, "checkSlinkBeforeRemove failed")
+		}
+	} else if c.exec.IsDir(fileInfo) {
+		isMounted, err := checkMountPointIsMounted(k8sPVDirectoryPath, c.logger, c.exec)
 		if err != nil {
-			message := "Controller: Idempotent - failed to eval the slink of the PV directory(k8s-mountpoint)"
-			if os.IsNotExist(err){
-				c.logger.Warning(message, logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath},{"error" , err}})
-				return true, nil
-			}
-			return true, c.logger.ErrorRet(err, message, logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+			return c.logger.ErrorRet(err, "checkMountPointIsMounted failed")
 		}
-		if evalSlink == realMountedPath {
-			c.logger.Info("PV directory(k8s-mountpoint) is slink that point to the right mountpoint.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", realMountedPath}})
-			return true, nil // Good path
+		if isMounted {
+			c.logger.Debug("Unmount the bind mount from PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", realMountedPath}})
+			if _, err := c.exec.Execute("umount", []string{k8sPVDirectoryPath}); err != nil {
+				return c.logger.ErrorRet(err, "failed to unmount PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+			}
 		} else {
-			// Very edge case, where the slink is point to wrong mountpoint
-			return true, c.logger.ErrorRet(
-				&wrongSlinkError{slink: k8sPVDirectoryPath, wrongPointTo: evalSlink, expectedPointTo: realMountedPath},
-				"failed")
+			c.logger.Warning("PV directory(k8s-mountpoint) is not mounted. Idempotent - skip unbind.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
 		}
 	} else {
-		return false, c.logger.ErrorRet(&k8sPVDirectoryIsNotSlinkError{k8sPVDirectoryPath, fileInfo}, "failed")
+		return c.logger.ErrorRet(&k8sPVDirectoryIsNotDirNorSlinkError{k8sPVDirectoryPath, fileInfo}, "failed")
 	}
 
+	c.logger.Debug("Removing the PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+	if err := c.exec.Remove(k8sPVDirectoryPath); err != nil {
+		return c.logger.ErrorRet(err, "fail to remove PV directory(k8s-mountpoint) "+k8sPVDirectoryPath)
+	}
+	return nil
 }
 
 func (c *Controller) getRealMountpointForPvByBackend(volumeBackend string, volumeConfig map[string]interface{}) (string, error) {
-	// TODO we should create agnostic function based on backend that returns the real mountpoint
 	defer c.logger.Trace(logs.DEBUG)()
-	if volumeBackend == resources.SCBE {
-		return fmt.Sprintf(resources.PathToMountUbiquityBlockDevices, volumeConfig["Wwn"].(string)), nil
-	} else if volumeBackend == resources.SpectrumScale {
-                return volumeConfig["mountpoint"].(string), nil
-		//TODO: scale should remove the mountpoint
-	} else {
-		return "", &PvBackendNotSupportedError{Backend: volumeBackend}
+	backendHandler, err := getBackendHandler(volumeBackend)
+	if err != nil {
+		return "", err
 	}
+	return backendHandler.GetRealMountpoint(volumeConfig)
 }
-func (c *Controller) doUnmount(k8sPVDirectoryPath string, volumeBackend string, volumeConfig map[string]interface{}, mounter resources.Mounter) error {
+func (c *Controller) doUnmount(k8sPVDirectoryPath string, volumeBackend string, volumeConfig map[string]interface{}, mounter resources.Mounter) (bool, error) {
 	/*
-		Call to unmount mounter if slink exist and then delete the slink
-		if slink not exist skip unmount (indicate for idempotent flow).
+		Remove the bind mount from the k8s directory (pod PV directory or kubelet device mount path)
+		and then call to unmount mounter only if no other k8s directory on the node still uses the global mountpoint.
+		Return true if the global mountpoint was unmounted.
 	*/
 	defer c.logger.Trace(logs.DEBUG)()
 	var realMountedPath string
-	var slinkExist bool
 	var err error
 	if realMountedPath, err = c.getRealMountpointForPvByBackend(volumeBackend, volumeConfig); err != nil {
-		return c.logger.ErrorRet(err, "getRealMountpointForPvByBackend failed")
+		return false, c.logger.ErrorRet(err, "getRealMountpointForPvByBackend failed")
 	}
 
-	// ------------------------------------
-	if slinkExist, err = c.checkSlinkBeforeUmount(k8sPVDirectoryPath, realMountedPath); err != nil {
-		return c.logger.ErrorRet(err, "checkSlinkBeforeUmount failed")
+	if err = c.removeK8sPVDirectory(k8sPVDirectoryPath, realMountedPath); err != nil {
+		return false, c.logger.ErrorRet(err, "removeK8sPVDirectory failed")
 	}
-	if slinkExist {
 
-		ubUnmountRequest := resources.UnmountRequest{VolumeConfig: volumeConfig} // TODO need to add to the request the real mountpoint to umount
-		if err := mounter.Unmount(ubUnmountRequest); err != nil {
-			return c.logger.ErrorRet(err, "mounter.Unmount failed")
-		}
+	users, err := getMountPointUsers(realMountedPath, k8sPVDirectoryPath, c.logger, c.exec)
+	if err != nil {
+		return false, c.logger.ErrorRet(err, "getMountPointUsers failed")
+	}
+	if len(users) > 0 {
+		c.logger.Info("The mountpoint is still in use on this node. Skip unmount of the mountpoint.", logs.Args{{"mountpoint", realMountedPath}, {"users", users}})
+		return false, nil
+	}
 
-		c.logger.Debug(fmt.Sprintf("Removing the slink [%s] to the real mountpoint [%s]", k8sPVDirectoryPath, realMountedPath))
-		if err := c.exec.Remove(k8sPVDirectoryPath); err != nil {
-			// the slink must exist at this point
-			return c.logger.ErrorRet(err, "fail to remove slink "+k8sPVDirectoryPath)
-		}
-	} else {
-		c.logger.Warning("PV directory(k8s-mountpoint) does not exist. Idempotent - skip unmount flow",
-			logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"should-point-to-mountpoint", realMountedPath}})
+	ubUnmountRequest := resources.UnmountRequest{VolumeConfig: volumeConfig} // TODO need to add to the request the real mountpoint to umount
+	rescanFlock, err := c.lockRescanFlock()
+	if err != nil {
+		return false, c.logger.ErrorRet(err, "lockRescanFlock failed")
 	}
-	return nil // Finish successfully to umount
+	err = mounter.Unmount(ubUnmountRequest)
+	rescanFlock.Unlock()
+	if err != nil {
+		return false, c.logger.ErrorRet(err, "mounter.Unmount failed")
+	}
+	return true, nil // Finish successfully to umount
 }
 
 //Unmount methods unmounts the volume from the pod
-func (c *Controller) Unmount(unmountRequest k8sresources.FlexVolumeUnmountRequest) k8sresources.FlexVolumeResponse {
+func (c *Controller) Unmount(unmountRequest k8sresources.FlexVolumeUnmountRequest) (response k8sresources.FlexVolumeResponse) {
 	go_id := logs.GetGoID()
 	logs.GoIdToRequestIdMap.Store(go_id, unmountRequest.Context)
 	defer logs.GetDeleteFromMapFunc(go_id)
 	defer c.logger.Trace(logs.DEBUG, logs.Args{{"unmountRequest", unmountRequest}})()
 	k8sPVDirectoryPath := unmountRequest.MountPath
-
-	// locking for concurrent rescans and reduce rescans if no need
-	c.logger.Debug("Ask for unmountFlock for mountpath", logs.Args{{"mountpath", k8sPVDirectoryPath}})
-	for {
-		err := c.unmountFlock.TryLock()
-		if err == nil {
-			break
+	defer func() {
+		if response.Status == FlexFailureStr {
+			c.recordPodEventByMountPath(k8sPVDirectoryPath, ReasonUnmountFailed, response.Message)
 		}
-		c.logger.Debug("unmountFlock.TryLock failed", logs.Args{{"error", err}})
-		time.Sleep(time.Duration(500 * time.Millisecond))
+	}()
+
+	pvName := path.Base(k8sPVDirectoryPath) // Assumption that the k8s mountpoint directory contains(basename) the pv name it self.
+	volumeFlock, err := c.lockVolumeFlock(pvName)
+	if err != nil {
+		return c.failureFlexVolumeResponse(err, "")
 	}
-	c.logger.Debug("Got unmountFlock for mountpath", logs.Args{{"mountpath", k8sPVDirectoryPath}})
-	defer c.unmountFlock.Unlock()
-	defer c.logger.Debug("Released unmountFlock for mountpath", logs.Args{{"mountpath", k8sPVDirectoryPath}})
+	defer volumeFlock.Unlock()
+	defer c.logger.Debug("Released volume flock for mountpath", logs.Args{{"mountpath", k8sPVDirectoryPath}})
 
 	var mounter resources.Mounter
 	var volumeConfig map[string]interface{}
 	var volume resources.Volume
-	var err error
 
 	// GetVolume by pv name to identify if it exist in ubiquity DB and to receive the backend
-	pvName := path.Base(k8sPVDirectoryPath) // Assumption that the k8s mountpoint directory contains(basename) the pv name it self.
-	getVolumeRequest := resources.GetVolumeRequest{Name: pvName}
-	if volume, err = c.Client.GetVolume(getVolumeRequest); err != nil {
+	var metadata *volumeMetadata
+	if volume, metadata, err = c.getVolumeWithFallback(pvName, unmountRequest.Context); err != nil {
 		if strings.Contains(err.Error(), resources.VolumeNotFoundErrorMsg) {
 			warningMsg := fmt.Sprintf("%s (backend error=%v)", IdempotentUnmountSkipOnVolumeNotExistWarnigMsg, err)
 			c.logger.Warning(warningMsg)
@@ -537,30 +852,47 @@ func (c *Controller) Unmount(unmountRequest k8sresources.FlexVolumeUnmountReques
 		}
 		return c.failureFlexVolumeResponse(err, "")
 	}
+	if metadata == nil {
+		c.reconcileVolumeMetadata(pvName, unmountRequest.Context)
+	}
 
 	if mounter, err = c.getMounterForBackend(volume.Backend, unmountRequest.Context); err != nil {
 		return c.failureFlexVolumeResponse(err, "Error determining mounter for volume. ")
 	}
 
-	getVolumeConfigRequest := resources.GetVolumeConfigRequest{Name: pvName}
-	if volumeConfig, err = c.Client.GetVolumeConfig(getVolumeConfigRequest); err != nil {
+	if volumeConfig, metadata, err = c.getVolumeConfigWithFallback(pvName, unmountRequest.Context, metadata); err != nil {
 		return c.failureFlexVolumeResponse(err, "Error unmount for volume. ")
 	}
 
-	if err := c.doUnmount(k8sPVDirectoryPath, volume.Backend, volumeConfig, mounter); err != nil {
+	isUnmounted, err := c.doUnmount(k8sPVDirectoryPath, volume.Backend, volumeConfig, mounter)
+	if err != nil {
 		return c.failureFlexVolumeResponse(err, "")
 	}
-
-	if (volume.Backend == resources.SpectrumScale) {
+	if !isUnmounted {
+		// Other pods on this node (or the kubelet device mount path) still use the volume, so keep it attached.
 		return c.successFlexVolumeResponse("")
-	} else if (volume.Backend == resources.SCBE) {
-	// Do legacy detach (means trigger detach as part of the umount from the k8s node)
+	}
+
+	backendHandler, err := getBackendHandler(volume.Backend)
+	if err != nil {
+		return c.failureFlexVolumeResponse(c.logger.ErrorRet(err, "failed"), "")
+	}
+	if !backendHandler.DetachAfterUnmount() {
+		c.deleteVolumeMetadata(pvName)
+	} else if metadata != nil {
+		// ubiquity is not reachable, so the legacy detach is done later by reconcileVolumeMetadata
+		metadata.DetachPending = true
+		if err := c.volumeMetadataStore.Save(*metadata); err != nil {
+			return c.failureFlexVolumeResponse(err, "Failed to save the pending detach of the volume. ")
+		}
+		c.logger.Warning("Volume is unmounted but ubiquity is not reachable, so its detach is pending.", logs.Args{{"volume", pvName}})
+		return c.successFlexVolumeResponse(VolumeMetadataFallbackWarningMsg)
+	} else {
+		// Do legacy detach (means trigger detach as part of the umount from the k8s node)
 		if err := c.doLegacyDetach(unmountRequest); err != nil {
 			return c.failureFlexVolumeResponse(err, "")
 		}
-	} else {
-		err = c.logger.ErrorRet(&PvBackendNotSupportedError{Backend: volume.Backend}, "failed")
-		return c.failureFlexVolumeResponse(err, "")
+		c.deleteVolumeMetadata(pvName)
 	}
 
 	return c.successFlexVolumeResponse("")
@@ -572,6 +904,13 @@ func (c *Controller) doLegacyDetach(unmountRequest k8sresources.FlexVolumeUnmoun
 
 	pvName := path.Base(unmountRequest.MountPath)
 	detachRequest := k8sresources.FlexVolumeDetachRequest{Name: pvName, Context: unmountRequest.Context}
+
+	// The detach is followed by the cleanup of the devices on the node
+	rescanFlock, err := c.lockRescanFlock()
+	if err != nil {
+		return c.logger.ErrorRet(err, "lockRescanFlock failed")
+	}
+	defer rescanFlock.Unlock()
 	err = c.doDetach(detachRequest, false)
 	if err != nil {
 		return c.logger.ErrorRet(err, "failed")
@@ -585,6 +924,119 @@ func (c *Controller) doLegacyDetach(unmountRequest k8sresources.FlexVolumeUnmoun
 	return nil
 }
 
+
+func (c *Controller) getVolumeWithFallback(volumeName string, requestContext resources.RequestContext) (resources.Volume, *volumeMetadata, error) {
+	/*
+		Get the volume from ubiquity. If ubiquity fails (e.g: its not reachable), fallback to the volume metadata
+		that was saved on the node during the mount. The returned metadata is not nil only if the fallback was used.
+		Volume not found error is returned as is, since there is nothing to fallback to.
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+
+	getVolumeRequest := resources.GetVolumeRequest{Name: volumeName, Context: requestContext}
+	volume, err := c.Client.GetVolume(getVolumeRequest)
+	if err == nil {
+		return volume, nil, nil
+	}
+	if strings.Contains(err.Error(), resources.VolumeNotFoundErrorMsg) {
+		c.deleteVolumeMetadata(volumeName)
+		return volume, nil, err
+	}
+
+	metadata := c.loadVolumeMetadata(volumeName)
+	if metadata == nil {
+		return volume, nil, err
+	}
+	c.logger.Warning("Failed to get the volume from ubiquity. Using the volume metadata saved on the node.", logs.Args{{"volume", volumeName}, {"error", err}})
+	return metadata.Volume, metadata, nil
+}
+
+func (c *Controller) getVolumeConfigWithFallback(volumeName string, requestContext resources.RequestContext, metadata *volumeMetadata) (map[string]interface{}, *volumeMetadata, error) {
+	defer c.logger.Trace(logs.DEBUG)()
+	if metadata != nil {
+		// Already in fallback mode, no need to try ubiquity again
+		return metadata.VolumeConfig, metadata, nil
+	}
+
+	getVolumeConfigRequest := resources.GetVolumeConfigRequest{Name: volumeName, Context: requestContext}
+	volumeConfig, err := c.Client.GetVolumeConfig(getVolumeConfigRequest)
+	if err == nil {
+		return volumeConfig, nil, nil
+	}
+
+	metadata = c.loadVolumeMetadata(volumeName)
+	if metadata == nil {
+		return nil, nil, err
+	}
+	c.logger.Warning("Failed to get the volume config from ubiquity. Using the volume metadata saved on the node.", logs.Args{{"volume", volumeName}, {"error", err}})
+	return metadata.VolumeConfig, metadata, nil
+}
+
+func (c *Controller) loadVolumeMetadata(volumeName string) *volumeMetadata {
+	metadata, err := c.volumeMetadataStore.Load(volumeName)
+	if err != nil {
+		c.logger.Warning("Failed to load the volume metadata saved on the node.", logs.Args{{"volume", volumeName}, {"error", err}})
+		return nil
+	}
+	return metadata
+}
+
+func (c *Controller) deleteVolumeMetadata(volumeName string) {
+	if err := c.volumeMetadataStore.Delete(volumeName); err != nil {
+		c.logger.Warning("Failed to delete the volume metadata saved on the node.", logs.Args{{"volume", volumeName}, {"error", err}})
+	}
+}
+
+func (c *Controller) reconcileVolumeMetadata(skipVolumeName string, requestContext resources.RequestContext) {
+	/*
+		Complete the legacy detach of volumes that were unmounted while ubiquity was not reachable.
+		Called only after ubiquity answered, failures are just logged and retried on the next call.
+		The caller holds the flock of its own volume, so volumes whose flock is busy are skipped instead of waited for.
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+
+	volumeNames, err := c.volumeMetadataStore.List()
+	if err != nil {
+		c.logger.Warning("Failed to list the volume metadata saved on the node.", logs.Args{{"error", err}})
+		return
+	}
+	for _, volumeName := range volumeNames {
+		if volumeName == skipVolumeName {
+			continue
+		}
+		metadata := c.loadVolumeMetadata(volumeName)
+		if metadata == nil || !metadata.DetachPending {
+			continue
+		}
+		c.reconcilePendingDetach(volumeName, requestContext)
+	}
+}
+
+func (c *Controller) reconcilePendingDetach(volumeName string, requestContext resources.RequestContext) {
+	defer c.logger.Trace(logs.DEBUG)()
+	volumeFlock, err := c.tryLockVolumeFlock(volumeName)
+	if err != nil {
+		c.logger.Info("Skip the pending detach of the volume, since its flock is busy. Will retry later.", logs.Args{{"volume", volumeName}, {"error", err}})
+		return
+	}
+	defer volumeFlock.Unlock()
+
+	// Check again under the volume lock, maybe the volume was already handled by a parallel flex call
+	metadata := c.loadVolumeMetadata(volumeName)
+	if metadata == nil || !metadata.DetachPending {
+		return
+	}
+
+	c.logger.Info("Detaching volume that was unmounted while ubiquity was not reachable.", logs.Args{{"volume", volumeName}})
+	unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: volumeName, Context: requestContext}
+	if err := c.doLegacyDetach(unmountRequest); err != nil {
+		if !strings.Contains(err.Error(), resources.VolumeNotFoundErrorMsg) {
+			c.logger.Warning("Failed to detach volume with pending detach. Will retry later.", logs.Args{{"volume", volumeName}, {"error", err}})
+			return
+		}
+	}
+	c.deleteVolumeMetadata(volumeName)
+}
 func (c *Controller) getMounterForBackend(backend string, requestContext resources.RequestContext) (resources.Mounter, error) {
 	defer c.logger.Trace(logs.DEBUG)()
 	var err error
@@ -606,23 +1058,14 @@ func (c *Controller) getMountpointForVolume(mountRequest k8sresources.FlexVolume
 
 	defer c.logger.Trace(logs.DEBUG)()
 
-	var volumeMountPoint string
-	var ok bool
+	backendHandler, err := getBackendHandler(volumeBackend)
+	if err != nil {
+		return "", c.logger.ErrorRet(err, "failed")
+	}
 
-	if (volumeBackend == resources.SpectrumScale) {
-		volumeMountPoint, ok = volumeConfig["mountpoint"].(string)
-		if !ok {
-			return "", c.logger.ErrorRet(&SpectrumScaleMissingMntPtVolumeError{VolumeName: mountRequest.MountDevice}, "failed")
-		}
-	} else if (volumeBackend == resources.SCBE) {
-		wwn, ok := mountRequest.Opts["Wwn"]
-		if !ok {
-			err := fmt.Errorf(MissingWwnMountRequestErrorStr)
-			return "", c.logger.ErrorRet(err, "failed")
-		}
-		volumeMountPoint = fmt.Sprintf(resources.PathToMountUbiquityBlockDevices, wwn)
-	} else {
-		return "", c.logger.ErrorRet(&PvBackendNotSupportedError{Backend: volumeBackend}, "failed")
+	volumeMountPoint, err := backendHandler.GetMountpointForMount(mountRequest, volumeConfig)
+	if err != nil {
+		return "", c.logger.ErrorRet(err, "failed")
 	}
 
 	return volumeMountPoint, nil
@@ -646,7 +1089,8 @@ func (c *Controller) prepareUbiquityMountRequest(mountRequest k8sresources.FlexV
 		return resources.MountRequest{}, err
 	}
 
-	ubMountRequest := resources.MountRequest{Mountpoint: volumeMountpoint, VolumeConfig: volumeConfig, Context: mountRequest.Context}
+	mounterVolumeConfig := c.getMounterVolumeConfig(mountRequest, volumeConfig)
+	ubMountRequest := resources.MountRequest{Mountpoint: volumeMountpoint, VolumeConfig: mounterVolumeConfig, Context: mountRequest.Context}
 	return ubMountRequest, nil
 }
 
@@ -685,6 +1129,24 @@ func getK8sPodsBaseDir(k8sMountPoint string) (string, error ){
 	return tempMountPoint, nil
 }
 
+func getK8sRootDir(k8sPath string) (string, error) {
+	/*
+		Get the kubelet root directory (e.g: /var/lib/kubelet) from one of the k8s directories the flex works with:
+			pod PV directory   : /var/lib/kubelet/pods/<pod-uid>/volumes/ibm~ubiquity-k8s-flex/<pv>
+			device mount path  : /var/lib/kubelet/plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts/<pv>
+	*/
+	deviceMountBaseDir := filepath.Dir(k8sPath)
+	if strings.HasSuffix(deviceMountBaseDir, "/"+k8sDeviceMountDirectoryName) {
+		return strings.TrimSuffix(deviceMountBaseDir, "/"+k8sDeviceMountDirectoryName), nil
+	}
+
+	k8sPodsBaseDir, err := getK8sPodsBaseDir(k8sPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(k8sPodsBaseDir), nil
+}
+
 func checkMountPointIsMounted(mountPoint string, logger logs.Logger, executer utils.Executor) (bool, error){
 	defer logger.Trace(logs.INFO, logs.Args{{"mountPoint", mountPoint}})()
 
@@ -707,83 +1169,84 @@ func checkMountPointIsMounted(mountPoint string, logger logs.Logger, executer ut
 }
 
 
-func checkSlinkAlreadyExistsOnMountPoint(mountPoint string, k8sMountPoint string, logger logs.Logger, executer utils.Executor) (error){
+func getMountPointUsers(mountPoint string, k8sPath string, logger logs.Logger, executer utils.Executor) ([]string, error) {
 	/*
-		the mountpoint parameter is the actual mountpoint we are pointing to: /ubiquity/WWN
-		the k8sMountPoint is the path to the link we want to create from the /var/lib/kubelet directory to the mountpoint
+		Return the k8s directories on this node that expose the given mountpoint (pods PV directories and kubelet device mount paths),
+		except of k8sPath itself.
+		the mountpoint parameter is the global mountpoint of the volume: /ubiquity/WWN
+		the k8sPath is the k8s directory that is being mounted or unmounted right now
 	*/
-	defer logger.Trace(logs.INFO, logs.Args{{"mountPoint", mountPoint}, {"k8sMountPoint", k8sMountPoint}})()
-	
-	k8sBaseDir, err := getK8sPodsBaseDir(k8sMountPoint)	
-	if err != nil{
-		return logger.ErrorRet(err, "Failed to get k8s pods base dir.", logs.Args{{"k8sMountPoint", k8sMountPoint}})
+	defer logger.Trace(logs.INFO, logs.Args{{"mountPoint", mountPoint}, {"k8sPath", k8sPath}})()
+	users := []string{}
+
+	k8sRootDir, err := getK8sRootDir(k8sPath)
+	if err != nil {
+		return nil, logger.ErrorRet(err, "Failed to get k8s root dir.", logs.Args{{"k8sPath", k8sPath}})
 	}
-		
-	file_pattern := filepath.Join(k8sBaseDir, "*","volumes", k8sMountPointvolumeDirectoryName,"*")
-	files, err := executer.GetGlobFiles(file_pattern)
-	if err != nil{
-		return logger.ErrorRet(err, "Failed to get files that match the pattern.", logs.Args{{"file_pattern", file_pattern}})
+
+	filePatterns := []string{
+		filepath.Join(k8sRootDir, K8sPodsDirecotryName, "*", "volumes", k8sMountPointvolumeDirectoryName, "*"),
+		filepath.Join(k8sRootDir, k8sDeviceMountDirectoryName, "*"),
 	}
-	
-	slinks := []string{}
+	files := []string{}
+	for _, filePattern := range filePatterns {
+		matches, err := executer.GetGlobFiles(filePattern)
+		if err != nil {
+			return nil, logger.ErrorRet(err, "Failed to get files that match the pattern.", logs.Args{{"file_pattern", filePattern}})
+		}
+		files = append(files, matches...)
+	}
+
 	if len(files) == 0 {
-		logger.Debug("There is no Pod that uses ibm flex PV on this node (No files matched the given pattern were found).", logs.Args{{"pattern", file_pattern}})
-		return nil
+		logger.Debug("There is no Pod that uses ibm flex PV on this node (No files matched the given patterns were found).", logs.Args{{"patterns", filePatterns}})
+		return users, nil
 	}
-	
+
 	mountStat, err := executer.Stat(mountPoint)
 	if err != nil {
-		if os.IsNotExist(err){
-			logger.Debug("Mount point path does not exist yet.", logs.Args{{"mountpoint",mountPoint}})
-			return nil
+		if os.IsNotExist(err) {
+			logger.Debug("Mount point path does not exist.", logs.Args{{"mountpoint", mountPoint}})
+			return users, nil
 		}
-		return logger.ErrorRet(err, "Failed to get stat for mount point file.", logs.Args{{"file", mountPoint}})
+		return nil, logger.ErrorRet(err, "Failed to get stat for mount point file.", logs.Args{{"file", mountPoint}})
 	}
-	
-	// go over the files and check if any of them is the same as our destinated mountpoint
-	// this checks if any of the solinks are pointing to the PV we want to mount.
+
+	// go over the files and check if any of them is bind mounted (or slink in older flex versions) to our mountpoint
 	for _, file := range files {
+		if file == k8sPath {
+			continue
+		}
 		fileStat, err := executer.Stat(file)
-		if err != nil{
+		if err != nil {
 			logger.Warning("Failed to get stat for file.", logs.Args{{"file", file}})
 			continue
 		}
-		
-		isSameFile := executer.IsSameFile(fileStat, mountStat)
-		if isSameFile{
-			isInUse, err := checkMountPointIsMounted(mountPoint, logger, executer)
-			if err != nil {
-				logger.Warning("Failed to check whether slink is in use.", logs.Args{{"file", file}})
-				continue
-			}
-			if isInUse{
-				slinks = append(slinks, file)
-			} else {
-				logger.Warning("Found a different Pod that uses the same PVC, but the slink is pointing to a directory that is NOT mounted. It may be a stale POD", logs.Args{{"pod directory", k8sMountPoint}, {"link target directory", mountPoint}})
-			}
-			
+
+		if !executer.IsSameFile(fileStat, mountStat) {
+			continue
+		}
+		isInUse, err := checkMountPointIsMounted(file, logger, executer)
+		if err != nil {
+			logger.Warning("Failed to check whether file is in use.", logs.Args{{"file", file}})
+			continue
+		}
+		if isInUse {
+			users = append(users, file)
+		} else {
+			logger.Warning("Found a different k8s directory that points to the same mountpoint, but it is NOT mounted. It may be a stale POD", logs.Args{{"k8s directory", file}, {"mountpoint", mountPoint}})
 		}
 	}
-		
-	if len(slinks) == 0 {
-		logger.Debug("There were no soft links pointing to given mountpoint.", logs.Args{{"mountpoint", mountPoint}})
-		return nil
-	}
-	
-	if len(slinks) > 1 {
-		return logger.ErrorRet(&PVIsAlreadyUsedByAnotherPod{mountPoint, slinks}, "More then 1 soft link was pointing to mountpoint.") 
-	}
-	
-	slink := slinks[0]
-	if slink != k8sMountPoint{
-		return logger.ErrorRet(&PVIsAlreadyUsedByAnotherPod{mountPoint, slinks}, "PV is used by another pod.") 
-	}
-	
-	return nil
+
+	logger.Debug("Found k8s directories that use the mountpoint.", logs.Args{{"mountpoint", mountPoint}, {"users", users}})
+	return users, nil
 }
 
 
 func (c *Controller) doMount(mountRequest k8sresources.FlexVolumeMountRequest) (string, error) {
+	/*
+		Mount the volume to its global mountpoint on the node (e.g: scbe backend its /ubiqutiy/<WWN>).
+		The mounter is idempotent so the global mountpoint is mounted only once, no matter how many pods use the volume.
+	*/
 	defer c.logger.Trace(logs.DEBUG)()
 
 	// Support only >=1.6
@@ -801,45 +1264,45 @@ func (c *Controller) doMount(mountRequest k8sresources.FlexVolumeMountRequest) (
 		return "", c.logger.ErrorRet(err, "prepareUbiquityMountRequest failed")
 	}
 
-	if (volumeBackend == resources.SCBE) {
-
-		err = checkSlinkAlreadyExistsOnMountPoint(ubMountRequest.Mountpoint, mountRequest.MountPath, c.logger, c.exec)
-		if err != nil {
-			return "", c.logger.ErrorRet(err, "Failed to check if other links point to mountpoint")
-		}
-	}
-
 	mountpoint, err := mounter.Mount(ubMountRequest)
 	if err != nil {
 		return "", c.logger.ErrorRet(err, "mounter.Mount failed")
 	}
 
+	// Keep the volume info on the node, so the volume can be unmounted even if ubiquity is not reachable
+	metadata := volumeMetadata{
+		Volume:       resources.Volume{Name: mountRequest.MountDevice, Backend: volumeBackend},
+		VolumeConfig: ubMountRequest.VolumeConfig,
+	}
+	if err := c.volumeMetadataStore.Save(metadata); err != nil {
+		c.logger.Warning("Failed to save the volume metadata on the node.", logs.Args{{"volume", mountRequest.MountDevice}, {"error", err}})
+	}
+
 	return mountpoint, nil
 }
 
 func (c *Controller) doAfterMount(mountRequest k8sresources.FlexVolumeMountRequest, mountedPath string) error {
 	/*
-		 Create symbolic link instead of the k8s PV directory that will point to the ubiquity mountpoint.
+		 Bind mount the global mountpoint of the volume into the k8s PV directory.
 		 For example(SCBE backend):
 		 	k8s PV directory : /var/lib/kubelet/pods/a9671a20-0fd6-11e8-b968-005056a41609/volumes/ibm~ubiquity-k8s-flex/pvc-6811c716-0f43-11e8-b968-005056a41609
-		 	symbolic link should be : /ubiquity/<WWN>
+		 	global mountpoint : /ubiquity/<WWN>
+		 The same flow is used by MountDevice, then the k8s PV directory is the device mount path of kubelet.
 		 Idempotent:
-		 	1. if k8s PV dir not exist, then just create the slink.
-		 	2. if k8s PV dir exist, then delete the dir and create slink instead.
-		 	3. if k8s PV dir is already slink to the right location, skip.
-		 	4. if k8s PV dir is already slink to wrong location, raise error.
-		 	5. else raise error.
+		 	1. if k8s PV dir not exist, then create the dir and bind mount.
+		 	2. if k8s PV dir exist and not mounted, then bind mount.
+		 	3. if k8s PV dir exist and already mounted to the right mountpoint, skip.
+		 	4. if k8s PV dir exist and already mounted to wrong mountpoint, raise error.
+		 	5. if k8s PV dir is already slink (created by older flex versions) to the right location, skip.
+		 	6. if k8s PV dir is already slink to wrong location, raise error.
+		 	7. else raise error.
 		 Params:
 		 	mountedPath : the real mountpoint (e.g: scbe backend its /ubiqutiy/<WWN>)
 		 	mountRequest.MountPath : the PV k8s directory
 		 k8s version support:
-		  	k8s version < 1.6 not supported. Note in version <1.6 the attach/mount,
-		  		the mountDir (MountPath) is not created trying to do mount and ln will fail because the dir is not found,
-		  		so we need to create the directory before continuing)
+		  	k8s version < 1.6 not supported.
 			k8s version >= 1.6 supported. Note in version >=1.6 the kubelet creates a folder as the MountPath,
-				including the volume name, whenwe try to create the symlink this will fail because the same name exists.
-				This is why we need to remove it before continuing.
-
+				including the volume name, so we just bind mount into it.
 	*/
 
 	defer c.logger.Trace(logs.DEBUG)()
@@ -848,56 +1311,235 @@ func (c *Controller) doAfterMount(mountRequest k8sresources.FlexVolumeMountReque
 
 	k8sPVDirectoryPath = mountRequest.MountPath
 
+	if err = c.applyMountOptions(mountRequest, mountedPath); err != nil {
+		return err
+	}
+
 	// Identify the PV directory by using Lstat and then handle all idempotent cases (use Lstat to get the dir or slink detail and not the evaluation of it)
 	fileInfo, err := c.exec.Lstat(k8sPVDirectoryPath)
 	if err != nil {
 		if c.exec.IsNotExist(err) {
 			// The k8s PV directory not exist (its a rare case and indicate on idempotent flow)
-			c.logger.Info("PV directory(k8s-mountpoint) nor slink do not exist. Idempotent - skip delete PV directory(k8s-mountpoint).", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"should-point-to-mountpoint", mountedPath}})
-			c.logger.Info("Creating slink(k8s-mountpoint) that point to mountpoint", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
-			err = c.exec.Symlink(mountedPath, k8sPVDirectoryPath)
-			if err != nil {
-				return c.logger.ErrorRet(err, "Controller: failed to create symlink")
+			c.logger.Info("PV directory(k8s-mountpoint) does not exist. Creating it.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
+			if err = c.exec.MkdirAll(k8sPVDirectoryPath, 0750); err != nil {
+				return c.logger.ErrorRet(err, "Controller: failed to create PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
 			}
 		} else {
 			// Maybe some permissions issue
 			return c.logger.ErrorRet(err, "Controller: failed to identify PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
 		}
 	} else if c.exec.IsDir(fileInfo) {
-		// Positive flow - the k8s-mountpoint should exist in advance and we should delete it in order to create slink instead
-		c.logger.Debug("As expected the PV directory(k8s-mountpoint) is a directory, so remove it to prepare slink to mountpoint instead", logs.Args{{"k8s-mountpath", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
-		err = c.exec.Remove(k8sPVDirectoryPath)
+		isMounted, err := checkMountPointIsMounted(k8sPVDirectoryPath, c.logger, c.exec)
 		if err != nil {
-			return c.logger.ErrorRet(
-				&FailRemovePVorigDirError{k8sPVDirectoryPath, err},
-				"failed")
+			return c.logger.ErrorRet(err, "checkMountPointIsMounted failed")
 		}
-		c.logger.Info("Creating slink(k8s-mountpoint) that point to mountpoint", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
-		err = c.exec.Symlink(mountedPath, k8sPVDirectoryPath)
-		if err != nil {
-			return c.logger.ErrorRet(err, "Controller: failed to create symlink")
+		if isMounted {
+			if err = c.checkBindMountBeforeMount(k8sPVDirectoryPath, mountedPath); err != nil {
+				return err
+			}
+			c.logger.Info("PV directory(k8s-mountpoint) is already mounted to the right mountpoint. Idempotent - skip bind mount.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
+			if isReadOnlyMountRequest(mountRequest) {
+				return c.remountReadOnly(k8sPVDirectoryPath)
+			}
+			return nil
 		}
 	} else if c.exec.IsSlink(fileInfo) {
-		// Its already slink so check if slink is ok and skip else raise error
+		// Its already slink (created by older flex versions) so check if slink is ok and skip else raise error
 		evalSlink, err := c.exec.EvalSymlinks(k8sPVDirectoryPath)
 		if err != nil {
 			return c.logger.ErrorRet(err, "Controller: Idempotent - failed eval the slink of PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
 		}
 		if evalSlink == mountedPath {
-			c.logger.Info("PV directory(k8s-mountpoint) is already slink and point to the right mountpoint. Idempotent - skip slink creation.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
-		} else {
-			return c.logger.ErrorRet(
-				&wrongSlinkError{slink: k8sPVDirectoryPath, wrongPointTo: evalSlink, expectedPointTo: mountedPath},
-				"failed")
+			if isReadOnlyMountRequest(mountRequest) {
+				c.logger.Warning("PV directory(k8s-mountpoint) is a slink, so the read-only mount cannot be enforced on it.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+			}
+			c.logger.Info("PV directory(k8s-mountpoint) is already slink and point to the right mountpoint. Idempotent - skip bind mount.", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
+			return nil
 		}
+		return c.logger.ErrorRet(
+			&wrongSlinkError{slink: k8sPVDirectoryPath, wrongPointTo: evalSlink, expectedPointTo: mountedPath},
+			"failed")
 	} else {
 		return c.logger.ErrorRet(&k8sPVDirectoryIsNotDirNorSlinkError{k8sPVDirectoryPath, fileInfo}, "failed")
 	}
 
+	c.logger.Info("Bind mount the mountpoint to PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
+	if _, err = c.exec.Execute("mount", []string{"--bind", mountedPath, k8sPVDirectoryPath}); err != nil {
+		return c.logger.ErrorRet(err, "Controller: failed to bind mount", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"mountpoint", mountedPath}})
+	}
+
+	if isReadOnlyMountRequest(mountRequest) {
+		if err = c.remountReadOnly(k8sPVDirectoryPath); err != nil {
+			// Never leave a writable bind mount behind for a read-only request
+			if _, unbindErr := c.exec.Execute("umount", []string{k8sPVDirectoryPath}); unbindErr != nil {
+				c.logger.Warning("Failed to unbind the PV directory(k8s-mountpoint)", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}, {"error", unbindErr}})
+			}
+			return err
+		}
+	}
+
+	if err = c.applyFsGroup(mountRequest, mountedPath); err != nil {
+		return err
+	}
+
 	c.logger.Debug("Volume mounted successfully", logs.Args{{"mountedPath", mountedPath}})
 	return nil
 }
 
+func (c *Controller) getMounterVolumeConfig(mountRequest k8sresources.FlexVolumeMountRequest, volumeConfig map[string]interface{}) map[string]interface{} {
+	/*
+		The mounter gets the fsType of the PV inside the volume config.
+		The read-only flag is not passed, the global mountpoint stays read-write and only the bind of the pod is remounted read-only.
+		The StorageClass mountOptions are applied by applyMountOptions after the mount.
+		The volume config is copied, so the config returned by ubiquity is not changed.
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+	mounterVolumeConfig := make(map[string]interface{}, len(volumeConfig)+1)
+	for key, value := range volumeConfig {
+		mounterVolumeConfig[key] = value
+	}
+
+	if fsType := mountRequest.Opts[k8sresources.OptionNameForFsType]; fsType != "" {
+		volumeFsType, exist := volumeConfig[k8sresources.VolumeConfigFsTypeKey].(string)
+		if !exist || volumeFsType == "" {
+			mounterVolumeConfig[k8sresources.VolumeConfigFsTypeKey] = fsType
+		} else if volumeFsType != fsType {
+			// The filesystem was already created by ubiquity, so the fstype of the volume wins.
+			c.logger.Warning("The PV fsType is different from the fstype of the volume. Using the fstype of the volume.", logs.Args{{"volume", mountRequest.MountDevice}, {"pvFsType", fsType}, {"volumeFsType", volumeFsType}})
+		}
+	}
+
+	return mounterVolumeConfig
+}
+
+func getMountOptions(opts map[string]string) []string {
+	mountOptions := []string{}
+	for _, mountOption := range strings.Split(opts[k8sresources.OptionNameForMountOptions], ",") {
+		if mountOption = strings.TrimSpace(mountOption); mountOption != "" {
+			mountOptions = append(mountOptions, mountOption)
+		}
+	}
+	return mountOptions
+}
+
+func (c *Controller) applyMountOptions(mountRequest k8sresources.FlexVolumeMountRequest, mountedPath string) error {
+	/*
+		Apply the StorageClass mountOptions by a remount of the global mountpoint, the bind mounts of the pods inherit them.
+		Skipped for backends whose global mountpoint is not a mount of its own (e.g: spectrum-scale fileset).
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+
+	mountOptions := getMountOptions(mountRequest.Opts)
+	if len(mountOptions) == 0 {
+		return nil
+	}
+
+	volume, _, err := c.getVolumeWithFallback(mountRequest.MountDevice, mountRequest.Context)
+	if err != nil {
+		return c.logger.ErrorRet(err, "getVolumeWithFallback failed")
+	}
+	backendHandler, err := getBackendHandler(volume.Backend)
+	if err != nil {
+		return c.logger.ErrorRet(err, "failed")
+	}
+	if !backendHandler.IsMountOptionsSupported() {
+		c.logger.Warning("The backend does not support mountOptions. Skip the mountOptions.", logs.Args{{"volume", mountRequest.MountDevice}, {"backend", volume.Backend}, {"mountOptions", mountOptions}})
+		return nil
+	}
+
+	c.logger.Info("Remount the mountpoint with the mountOptions", logs.Args{{"mountpoint", mountedPath}, {"mountOptions", mountOptions}})
+	remountOptions := "remount," + strings.Join(mountOptions, ",")
+	if _, err := c.exec.Execute("mount", []string{"-o", remountOptions, mountedPath}); err != nil {
+		return c.logger.ErrorRet(err, "Controller: failed to remount with the mountOptions", logs.Args{{"mountpoint", mountedPath}, {"mountOptions", mountOptions}})
+	}
+	return nil
+}
+
+func (c *Controller) remountReadOnly(k8sPVDirectoryPath string) error {
+	// A bind mount gets the flags of its source mount, so the read-only flag must be set by a remount of the bind itself.
+	defer c.logger.Trace(logs.DEBUG)()
+	c.logger.Info("Remount the PV directory(k8s-mountpoint) as read-only", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+	if _, err := c.exec.Execute("mount", []string{"-o", "remount,bind,ro", k8sPVDirectoryPath}); err != nil {
+		return c.logger.ErrorRet(err, "Controller: failed to remount as read-only", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+	}
+	return nil
+}
+
+func (c *Controller) applyFsGroup(mountRequest k8sresources.FlexVolumeMountRequest, mountedPath string) error {
+	/*
+		Give the fsGroup of the pod group ownership and group write permission on the mounted filesystem, like kubelet does for its own volume plugins.
+		The setgid bit on the root directory makes new files and directories inherit the group.
+		Skipped if the fsGroup is not provided, for read-only mounts and if disabled in the flex config.
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+
+	fsGroup := mountRequest.Opts[k8sresources.OptionNameForFsGroup]
+	if fsGroup == "" || isReadOnlyMountRequest(mountRequest) {
+		return nil
+	}
+	if c.flexConfig.DisableFsGroup {
+		c.logger.Info("fsGroup is disabled in the flex config. Skip the group ownership of the mountpoint.", logs.Args{{"mountpoint", mountedPath}, {"fsGroup", fsGroup}})
+		return nil
+	}
+	gid, err := strconv.ParseUint(fsGroup, 10, 32)
+	if err != nil {
+		return c.logger.ErrorRet(&InvalidFsGroupError{FsGroup: fsGroup}, "failed")
+	}
+	if c.isFsGroupApplied(mountedPath, uint32(gid)) {
+		// Every pod of the volume mounts it again, so skip the recursive chgrp of a volume that already has the fsGroup.
+		c.logger.Info("The fsGroup ownership and permissions are already applied on the mountpoint", logs.Args{{"mountpoint", mountedPath}, {"fsGroup", fsGroup}})
+		return nil
+	}
+
+	c.logger.Info("Apply the fsGroup ownership and permissions on the mountpoint", logs.Args{{"mountpoint", mountedPath}, {"fsGroup", fsGroup}})
+	fsGroupCommands := [][]string{
+		{"chgrp", "-R", fsGroup, mountedPath},
+		{"chmod", "-R", "g+rwX", mountedPath},
+		{"chmod", "g+s", mountedPath},
+	}
+	for _, fsGroupCommand := range fsGroupCommands {
+		if _, err := c.exec.Execute(fsGroupCommand[0], fsGroupCommand[1:]); err != nil {
+			return c.logger.ErrorRet(err, "Controller: failed to apply the fsGroup", logs.Args{{"mountpoint", mountedPath}, {"command", fsGroupCommand}})
+		}
+	}
+	return nil
+}
+
+func (c *Controller) isFsGroupApplied(mountedPath string, gid uint32) bool {
+	// The fsGroup is applied if the root directory has the group, the group permissions and the setgid bit.
+	fileInfo, err := c.exec.Stat(mountedPath)
+	if err != nil || fileInfo == nil {
+		return false
+	}
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	mode := fileInfo.Mode()
+	return stat.Gid == gid && mode&os.ModeSetgid != 0 && mode.Perm()&0070 == 0070
+}
+
+func isReadOnlyMountRequest(mountRequest k8sresources.FlexVolumeMountRequest) bool {
+	return mountRequest.Opts[k8sresources.OptionNameForReadWrite] == k8sresources.OptionValueReadOnly
+}
+
+func (c *Controller) checkBindMountBeforeMount(k8sPVDirectoryPath string, mountedPath string) error {
+	defer c.logger.Trace(logs.DEBUG)()
+
+	k8sPVDirectoryStat, err := c.exec.Stat(k8sPVDirectoryPath)
+	if err != nil {
+		return c.logger.ErrorRet(err, "Failed to get stat for PV directory(k8s-mountpoint).", logs.Args{{"k8s-mountpoint", k8sPVDirectoryPath}})
+	}
+	mountedPathStat, err := c.exec.Stat(mountedPath)
+	if err != nil {
+		return c.logger.ErrorRet(err, "Failed to get stat for mountpoint.", logs.Args{{"mountpoint", mountedPath}})
+	}
+	if !c.exec.IsSameFile(k8sPVDirectoryStat, mountedPathStat) {
+		return c.logger.ErrorRet(&k8sPVDirectoryIsMountedToWrongMountpointError{k8sPVDirectoryPath, mountedPath}, "failed")
+	}
+	return nil
+}
+
 func (c *Controller) doAfterDetach(detachRequest k8sresources.FlexVolumeDetachRequest) error {
 	defer c.logger.Trace(logs.DEBUG)()
 
@@ -988,6 +1630,80 @@ func (c *Controller) doAttach(attachRequest k8sresources.FlexVolumeAttachRequest
 	return nil
 }
 
+func (c *Controller) doWaitForAttach(waitForAttachRequest k8sresources.FlexVolumeWaitForAttachRequest, volName string) (string, error) {
+	/*
+		Wait until the multipath device of the SCBE volume shows up on the node and return the real device path (e.g: /dev/dm-3).
+		The WWN is taken from the PV options that the provisioner wrote, if its missing we fallback to the volume config in ubiquity.
+		The SCSI bus is rescanned only once, since the rescan holds the node wide rescan flock that all the other attach,
+		detach and cleanup flows of the node wait for. Then the device is polled, udev creates its link once multipath maps it.
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+
+	wwn, ok := waitForAttachRequest.Opts["Wwn"]
+	if !ok {
+		getVolumeConfigRequest := resources.GetVolumeConfigRequest{Name: volName, Context: waitForAttachRequest.Context}
+		volumeConfig, err := c.Client.GetVolumeConfig(getVolumeConfigRequest)
+		if err != nil {
+			return "", c.logger.ErrorRet(err, "Client.GetVolumeConfig failed")
+		}
+		if wwn, ok = volumeConfig["Wwn"].(string); !ok {
+			return "", c.logger.ErrorRet(fmt.Errorf(MissingWwnMountRequestErrorStr), "failed")
+		}
+	}
+
+	deviceLink := fmt.Sprintf(multipathDeviceByIdPathTemplate, strings.ToLower(wwn))
+	deadline := time.Now().Add(c.waitForAttachTimeout)
+	c.rescanScsi()
+	for {
+		_, err := c.exec.Stat(deviceLink)
+		if err == nil {
+			devicePath, err := c.exec.EvalSymlinks(deviceLink)
+			if err != nil {
+				return "", c.logger.ErrorRet(err, "failed to eval the multipath device link", logs.Args{{"link", deviceLink}})
+			}
+			c.logger.Info("Volume device is attached to the node", logs.Args{{"volume", volName}, {"wwn", wwn}, {"device", devicePath}})
+			return devicePath, nil
+		}
+		if !c.exec.IsNotExist(err) {
+			return "", c.logger.ErrorRet(err, "failed to stat the multipath device link", logs.Args{{"link", deviceLink}})
+		}
+		if !time.Now().Before(deadline) {
+			return "", c.logger.ErrorRet(&WaitForAttachTimeoutError{VolumeName: volName, Wwn: wwn, Timeout: c.waitForAttachTimeout}, "failed")
+		}
+		c.logger.Debug("Volume device is not attached yet, waiting", logs.Args{{"volume", volName}, {"link", deviceLink}})
+		time.Sleep(c.waitForAttachInterval)
+	}
+}
+
+func (c *Controller) rescanScsi() {
+	/*
+		Trigger SCSI rescan so new volumes that were mapped to this host will be discovered,
+		and then run multipath to create the multipath devices for them.
+		Failures are only logged, since the device may show up anyway (e.g: by udev).
+	*/
+	defer c.logger.Trace(logs.DEBUG)()
+	rescanFlock, err := c.lockRescanFlock()
+	if err != nil {
+		c.logger.Warning("Skip the rescan, since the rescan flock is not available", logs.Args{{"error", err}})
+		return
+	}
+	defer rescanFlock.Unlock()
+
+	for _, rescanCmd := range rescanScsiCommands {
+		if err := c.exec.IsExecutable(rescanCmd); err != nil {
+			continue
+		}
+		if _, err := c.exec.Execute(rescanCmd, []string{}); err != nil {
+			c.logger.Warning("SCSI rescan failed", logs.Args{{"command", rescanCmd}, {"error", err}})
+		}
+		if _, err := c.exec.Execute("multipath", []string{}); err != nil {
+			c.logger.Warning("multipath failed", logs.Args{{"error", err}})
+		}
+		return
+	}
+	c.logger.Warning("No SCSI rescan command found, skip rescan", logs.Args{{"commands", rescanScsiCommands}})
+}
+
 func (c *Controller) doDetach(detachRequest k8sresources.FlexVolumeDetachRequest, checkIfAttached bool) error {
 	defer c.logger.Trace(logs.DEBUG)()
 
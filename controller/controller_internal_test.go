@@ -7,15 +7,36 @@ package controller
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/IBM/ubiquity/utils/logs"
 	"github.com/IBM/ubiquity/fakes"
+	"github.com/IBM/ubiquity/resources"
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	testcore "k8s.io/client-go/testing"
 )
 
 
 
 var _ = Describe("controller_internal_tests", func() {
+	var volumeMetadataDir string
+	BeforeEach(func() {
+		var err error
+		volumeMetadataDir, err = ioutil.TempDir("", "ubiquity-k8s-flex-volumes")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(volumeMetadataDir)
+	})
 	Context(".getK8sBaseDir", func() {
 		It("should succeed if path is correct", func() {
 			res, err := getK8sPodsBaseDir("/var/lib/kubelet/pods/1f94f1d9-8f36-11e8-b227-005056a4d4cb/volumes/ibm~ubiquity-k8s-flex/pvc-123")
@@ -42,7 +63,252 @@ var _ = Describe("controller_internal_tests", func() {
 			Expect(res).To(Equal(""))
 		})
 	})
-	Context(".checkSlinkAlreadyExistsOnMountPoint", func() {
+	Context(".getBackendHandler", func() {
+		It("should return the registered handlers of scbe and spectrum-scale", func() {
+			handler, err := getBackendHandler(resources.SCBE)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.IsAttachSupported()).To(BeTrue())
+			Expect(handler.DetachAfterUnmount()).To(BeTrue())
+
+			handler, err = getBackendHandler(resources.SpectrumScale)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.IsAttachSupported()).To(BeFalse())
+			Expect(handler.DetachAfterUnmount()).To(BeFalse())
+		})
+		It("should fail if no handler is registered for the backend", func() {
+			handler, err := getBackendHandler("fake")
+			Expect(err).To(Equal(&PvBackendNotSupportedError{Backend: "fake"}))
+			Expect(handler).To(BeNil())
+		})
+		It("should panic if a handler with the same name is registered twice", func() {
+			Expect(func() { RegisterBackendHandler(&scbeBackendHandler{}) }).To(Panic())
+		})
+		It("should resolve the scbe real mountpoint by the volume wwn", func() {
+			handler, _ := getBackendHandler(resources.SCBE)
+			mountpoint, err := handler.GetRealMountpoint(map[string]interface{}{"Wwn": "wwn1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mountpoint).To(Equal("/ubiquity/wwn1"))
+			_, err = handler.GetRealMountpoint(map[string]interface{}{})
+			Expect(err).To(MatchError(MissingWwnMountRequestErrorStr))
+		})
+	})
+	Context(".lockVolumeFlock", func() {
+		It("should hold a separate lock file per volume and release it on unlock", func() {
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), new(fakes.FakeExecutor), new(fakes.FakeMounterFactory), volumeMetadataDir)
+
+			flock1, err := c.lockVolumeFlock("pv-lock-test1")
+			Expect(err).NotTo(HaveOccurred())
+			flock2, err := c.lockVolumeFlock("pv-lock-test2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(flock1)).To(Equal(filepath.Join(os.TempDir(), "ubiquity.volume.pv-lock-test1.lock")))
+			Expect(string(flock2)).To(Equal(filepath.Join(os.TempDir(), "ubiquity.volume.pv-lock-test2.lock")))
+			Expect(string(flock1)).To(BeAnExistingFile())
+
+			Expect(flock1.Unlock()).To(Succeed())
+			Expect(string(flock1)).NotTo(BeAnExistingFile())
+			Expect(string(flock2)).To(BeAnExistingFile())
+			Expect(flock2.Unlock()).To(Succeed())
+		})
+		It("should reclaim a flock that is held by a dead process", func() {
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), new(fakes.FakeExecutor), new(fakes.FakeMounterFactory), volumeMetadataDir)
+			deadProcess := exec.Command("true")
+			Expect(deadProcess.Run()).To(Succeed())
+			flockPath := filepath.Join(os.TempDir(), "ubiquity.volume.pv-lock-test-dead.lock")
+			Expect(ioutil.WriteFile(flockPath, []byte(fmt.Sprintf("%d\n", deadProcess.Process.Pid)), 0644)).To(Succeed())
+
+			flock, err := c.lockVolumeFlock("pv-lock-test-dead")
+			Expect(err).NotTo(HaveOccurred())
+			owner, err := flock.GetOwner()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owner.Pid).To(Equal(os.Getpid()))
+			Expect(flock.Unlock()).To(Succeed())
+		})
+		It("should fail with the owner pid if the flock is not released before the timeout", func() {
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), new(fakes.FakeExecutor), new(fakes.FakeMounterFactory), volumeMetadataDir)
+			c.flockTimeout = 50 * time.Millisecond
+			c.flockInterval = 10 * time.Millisecond
+			liveProcess := exec.Command("sleep", "10")
+			Expect(liveProcess.Start()).To(Succeed())
+			defer liveProcess.Process.Kill()
+			flockPath := filepath.Join(os.TempDir(), "ubiquity.volume.pv-lock-test-busy.lock")
+			Expect(ioutil.WriteFile(flockPath, []byte(fmt.Sprintf("%d\n", liveProcess.Process.Pid)), 0644)).To(Succeed())
+			defer os.Remove(flockPath)
+
+			_, err := c.lockVolumeFlock("pv-lock-test-busy")
+			Expect(err).To(Equal(&FlockTimeoutError{Flock: flockPath, OwnerPid: liveProcess.Process.Pid, Timeout: c.flockTimeout}))
+			Expect(flockPath).To(BeAnExistingFile())
+		})
+	})
+	Context(".reconcileVolumeMetadata", func() {
+		It("should skip the pending detach of a volume whose flock is held, without waiting for it", func() {
+			fakeClient := new(fakes.FakeStorageClient)
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, fakeClient, new(fakes.FakeExecutor), new(fakes.FakeMounterFactory), volumeMetadataDir)
+			err := c.volumeMetadataStore.Save(volumeMetadata{Volume: resources.Volume{Name: "pv-reconcile-busy", Backend: resources.SCBE}, DetachPending: true})
+			Expect(err).NotTo(HaveOccurred())
+			liveProcess := exec.Command("sleep", "10")
+			Expect(liveProcess.Start()).To(Succeed())
+			defer liveProcess.Process.Kill()
+			flockPath := filepath.Join(os.TempDir(), "ubiquity.volume.pv-reconcile-busy.lock")
+			Expect(ioutil.WriteFile(flockPath, []byte(fmt.Sprintf("%d\n", liveProcess.Process.Pid)), 0644)).To(Succeed())
+			defer os.Remove(flockPath)
+
+			start := time.Now()
+			c.reconcileVolumeMetadata("pv1", resources.RequestContext{})
+
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(fakeClient.DetachCallCount()).To(Equal(0))
+			metadata, err := c.volumeMetadataStore.Load("pv-reconcile-busy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.DetachPending).To(BeTrue())
+			Expect(flockPath).To(BeAnExistingFile())
+		})
+	})
+	Context(".getMounterVolumeConfig", func() {
+		var c *Controller
+		BeforeEach(func() {
+			c = NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), new(fakes.FakeExecutor), new(fakes.FakeMounterFactory), volumeMetadataDir)
+		})
+		It("should keep the fstype of the volume if the PV fsType is different", func() {
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountDevice: "pv1", Opts: map[string]string{k8sresources.OptionNameForFsType: "xfs"}}
+
+			volumeConfig := c.getMounterVolumeConfig(mountRequest, map[string]interface{}{k8sresources.VolumeConfigFsTypeKey: "ext4"})
+
+			Expect(volumeConfig).To(HaveKeyWithValue(k8sresources.VolumeConfigFsTypeKey, "ext4"))
+		})
+		It("should not pass the k8s mountOptions to the mounter", func() {
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountDevice: "pv1", Opts: map[string]string{k8sresources.OptionNameForMountOptions: "noatime"}}
+
+			volumeConfig := c.getMounterVolumeConfig(mountRequest, map[string]interface{}{"Wwn": "fake"})
+
+			Expect(volumeConfig).To(Equal(map[string]interface{}{"Wwn": "fake"}))
+		})
+	})
+	Context(".applyFsGroup", func() {
+		It("should skip the fsGroup ownership if it is disabled in the flex config", func() {
+			fakeExecutor := new(fakes.FakeExecutor)
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), fakeExecutor, new(fakes.FakeMounterFactory), volumeMetadataDir)
+			c.flexConfig = k8sresources.UbiquityK8sFlexConfig{DisableFsGroup: true}
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountDevice: "pv1", Opts: map[string]string{k8sresources.OptionNameForFsGroup: "2000"}}
+
+			err := c.applyFsGroup(mountRequest, "/ubiquity/wwn1")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeExecutor.ExecuteCallCount()).To(Equal(0))
+		})
+		It("should skip the fsGroup ownership if fsGroup is not provided", func() {
+			fakeExecutor := new(fakes.FakeExecutor)
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), fakeExecutor, new(fakes.FakeMounterFactory), volumeMetadataDir)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountDevice: "pv1", Opts: map[string]string{}}
+
+			err := c.applyFsGroup(mountRequest, "/ubiquity/wwn1")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeExecutor.ExecuteCallCount()).To(Equal(0))
+		})
+		It("should fail if the chgrp failed", func() {
+			fakeExecutor := new(fakes.FakeExecutor)
+			fakeExecutor.ExecuteReturns(nil, fmt.Errorf("chgrp error"))
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), fakeExecutor, new(fakes.FakeMounterFactory), volumeMetadataDir)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountDevice: "pv1", Opts: map[string]string{k8sresources.OptionNameForFsGroup: "2000"}}
+
+			err := c.applyFsGroup(mountRequest, "/ubiquity/wwn1")
+
+			Expect(err).To(MatchError("chgrp error"))
+			Expect(fakeExecutor.ExecuteCallCount()).To(Equal(1))
+		})
+		It("should skip the fsGroup ownership if the mountpoint already has the fsGroup", func() {
+			mountedPath := filepath.Join(volumeMetadataDir, "wwn1")
+			Expect(os.Mkdir(mountedPath, 0755)).To(Succeed())
+			Expect(os.Chmod(mountedPath, 0775|os.ModeSetgid)).To(Succeed())
+			fileInfo, err := os.Stat(mountedPath)
+			Expect(err).NotTo(HaveOccurred())
+			fsGroup := fmt.Sprintf("%d", fileInfo.Sys().(*syscall.Stat_t).Gid)
+			fakeExecutor := new(fakes.FakeExecutor)
+			fakeExecutor.StatReturns(fileInfo, nil)
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), fakeExecutor, new(fakes.FakeMounterFactory), volumeMetadataDir)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountDevice: "pv1", Opts: map[string]string{k8sresources.OptionNameForFsGroup: fsGroup}}
+
+			err = c.applyFsGroup(mountRequest, mountedPath)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeExecutor.StatArgsForCall(0)).To(Equal(mountedPath))
+			Expect(fakeExecutor.ExecuteCallCount()).To(Equal(0))
+		})
+		It("should apply the fsGroup ownership if the mountpoint has the group but not the setgid bit", func() {
+			mountedPath := filepath.Join(volumeMetadataDir, "wwn1")
+			Expect(os.Mkdir(mountedPath, 0775)).To(Succeed())
+			fileInfo, err := os.Stat(mountedPath)
+			Expect(err).NotTo(HaveOccurred())
+			fsGroup := fmt.Sprintf("%d", fileInfo.Sys().(*syscall.Stat_t).Gid)
+			fakeExecutor := new(fakes.FakeExecutor)
+			fakeExecutor.StatReturns(fileInfo, nil)
+			c := NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), fakeExecutor, new(fakes.FakeMounterFactory), volumeMetadataDir)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountDevice: "pv1", Opts: map[string]string{k8sresources.OptionNameForFsGroup: fsGroup}}
+
+			err = c.applyFsGroup(mountRequest, mountedPath)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeExecutor.ExecuteCallCount()).To(Equal(3))
+		})
+	})
+	Context(".volumeMetadataStore", func() {
+		var (
+			store *volumeMetadataStore
+			dir   string
+		)
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "ubiquity-k8s-flex-test")
+			Expect(err).NotTo(HaveOccurred())
+			store = newVolumeMetadataStore(dir + "/volumes")
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		It("should return nil if there is no metadata for the volume", func() {
+			metadata, err := store.Load("pv1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata).To(BeNil())
+		})
+		It("should load the saved metadata and list it", func() {
+			err := store.Save(volumeMetadata{Volume: resources.Volume{Name: "pv1", Backend: resources.SCBE}, VolumeConfig: map[string]interface{}{"Wwn": "wwn1"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			metadata, err := store.Load("pv1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.Volume.Backend).To(Equal(resources.SCBE))
+			Expect(metadata.VolumeConfig["Wwn"]).To(Equal("wwn1"))
+			Expect(metadata.DetachPending).To(BeFalse())
+			Expect(store.List()).To(Equal([]string{"pv1"}))
+		})
+		It("should delete the metadata and be idempotent", func() {
+			err := store.Save(volumeMetadata{Volume: resources.Volume{Name: "pv1", Backend: resources.SCBE}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(store.Delete("pv1")).To(Succeed())
+			Expect(store.Delete("pv1")).To(Succeed())
+			Expect(store.List()).To(BeEmpty())
+		})
+	})
+	Context(".getK8sRootDir", func() {
+		It("should succeed if path is a pod PV directory", func() {
+			res, err := getK8sRootDir("/var/lib/kubelet/pods/1f94f1d9-8f36-11e8-b227-005056a4d4cb/volumes/ibm~ubiquity-k8s-flex/pvc-123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal("/var/lib/kubelet"))
+		})
+		It("should succeed if path is a kubelet device mount path", func() {
+			res, err := getK8sRootDir("/tmp/kubelet/plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts/pvc-123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal("/tmp/kubelet"))
+		})
+		It("should fail if path is not of correct structure", func() {
+			k8smountpoint := "/tmp/kubelet/something"
+			res, err := getK8sRootDir(k8smountpoint)
+			Expect(err).To(Equal(&WrongK8sDirectoryPathError{k8smountpoint}))
+			Expect(res).To(Equal(""))
+		})
+	})
+	Context(".getMountPointUsers", func() {
 		var (
 			fakeExecutor *fakes.FakeExecutor
 			mountPoint string
@@ -51,68 +317,81 @@ var _ = Describe("controller_internal_tests", func() {
 			fakeExecutor = new(fakes.FakeExecutor)
 			mountPoint = "/tmp/kubelet/pods/1f94f1d9-8f36-11e8-b227-005056a4d4cb/volumes/ibm~ubiquity-k8s-flex/pvc-123"
 		})
-		It("should return no error if it is the first volume", func() {
+		It("should return no users if it is the first volume", func() {
+			fakeExecutor.GetGlobFilesReturns([]string{}, nil)
+			users, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
+			Expect(err).To(BeNil())
+			Expect(users).To(BeEmpty())
+		})
+		It("should glob both the pods directories and the kubelet device mount directory", func() {
 			fakeExecutor.GetGlobFilesReturns([]string{}, nil)
-			err := checkSlinkAlreadyExistsOnMountPoint("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
+			_, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).To(BeNil())
+			Expect(fakeExecutor.GetGlobFilesCallCount()).To(Equal(2))
+			Expect(fakeExecutor.GetGlobFilesArgsForCall(0)).To(Equal("/tmp/kubelet/pods/*/volumes/ibm~ubiquity-k8s-flex/*"))
+			Expect(fakeExecutor.GetGlobFilesArgsForCall(1)).To(Equal("/tmp/kubelet/plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts/*"))
 		})
-		It("should return no error if there are no other links", func() {
+		It("should return no users if there are no other directories on the same mountpoint", func() {
 			fakeExecutor.GetGlobFilesReturns([]string{"/tmp/file1", "/tmp/file2"}, nil)
 			fakeExecutor.IsSameFileReturns(false)
-			err:= checkSlinkAlreadyExistsOnMountPoint("mountPoint",mountPoint, logs.GetLogger(), fakeExecutor)
+			users, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).To(BeNil())
+			Expect(users).To(BeEmpty())
 		})
-		It("should return an error if this mountpoint already has links", func() {
+		It("should return the users if this mountpoint is already mounted by other directories", func() {
 			file := "/tmp/file1"
 			fakeExecutor.GetDeviceForFileStatReturnsOnCall(0, 12)
 			fakeExecutor.GetDeviceForFileStatReturnsOnCall(1, 15)
-			fakeExecutor.GetGlobFilesReturns([]string{file}, nil)
+			fakeExecutor.GetGlobFilesReturnsOnCall(0, []string{file}, nil)
+			fakeExecutor.GetGlobFilesReturnsOnCall(1, []string{}, nil)
 			fakeExecutor.IsSameFileReturns(true)
-			err:= checkSlinkAlreadyExistsOnMountPoint("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
-			Expect(err).ToNot(BeNil())
-			Expect(err).To(Equal(&PVIsAlreadyUsedByAnotherPod{"mountPoint", []string{file}}))
+			users, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
+			Expect(err).To(BeNil())
+			Expect(users).To(Equal([]string{file}))
 		})
-		It("should not return an error if this mountpoint already has links that are not mounted", func() {
+		It("should not return directories that point to this mountpoint but are not mounted", func() {
 			file := "/tmp/file1"
 			fakeExecutor.GetDeviceForFileStatReturnsOnCall(0, 12)
 			fakeExecutor.GetDeviceForFileStatReturnsOnCall(1, 12)
-			fakeExecutor.GetGlobFilesReturns([]string{file}, nil)
+			fakeExecutor.GetGlobFilesReturnsOnCall(0, []string{file}, nil)
+			fakeExecutor.GetGlobFilesReturnsOnCall(1, []string{}, nil)
 			fakeExecutor.IsSameFileReturns(true)
-			err:= checkSlinkAlreadyExistsOnMountPoint("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
+			users, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).To(BeNil())
+			Expect(users).To(BeEmpty())
 		})
-		It("should return no errors if this mountpoint has only one links and it is the current pvc", func() {
-			file := mountPoint
-			fakeExecutor.GetGlobFilesReturns([]string{file}, nil)
+		It("should return no users if the only directory on this mountpoint is the current pvc", func() {
+			fakeExecutor.GetGlobFilesReturns([]string{mountPoint}, nil)
 			fakeExecutor.IsSameFileReturns(true)
-			err := checkSlinkAlreadyExistsOnMountPoint("mountPoint", file, logs.GetLogger(), fakeExecutor)
+			users, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).To(BeNil())
+			Expect(users).To(BeEmpty())
 		})
-		It("should return error if getk8sbaseDir returns an error", func() {
+		It("should return error if getK8sRootDir returns an error", func() {
 			k8sMountPoint := "/tmp/kubelet/something"
-			err := checkSlinkAlreadyExistsOnMountPoint("mountPoint", k8sMountPoint, logs.GetLogger(), fakeExecutor)
+			_, err := getMountPointUsers("mountPoint", k8sMountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).To(Equal(&WrongK8sDirectoryPathError{k8sMountPoint}))
 		})
-		It("should return error if glob  returns an error", func() {
+		It("should return error if glob returns an error", func() {
 			errstrObj := fmt.Errorf("An error ooccured")
 			fakeExecutor.GetGlobFilesReturns(nil, errstrObj)
-			err := checkSlinkAlreadyExistsOnMountPoint("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
+			_, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).To(Equal(errstrObj))
-
 		})
 		It("should return error if stat function on the mountpoint returns an error", func() {
 			errstrObj := fmt.Errorf("An error ooccured")
 			fakeExecutor.GetGlobFilesReturns([]string{"/tmp/file1"}, nil)
 			fakeExecutor.StatReturns(nil, errstrObj)
-			err:= checkSlinkAlreadyExistsOnMountPoint("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
+			_, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).To(Equal(errstrObj))
 		})
-		It("should continue if stat on a link returns an error", func() {
+		It("should continue if stat on a directory returns an error", func() {
 			errstrObj := fmt.Errorf("An error ooccured")
 			fakeExecutor.GetGlobFilesReturns([]string{"/tmp/file1"}, nil)
 			fakeExecutor.StatReturnsOnCall(1, nil, errstrObj)
-			err := checkSlinkAlreadyExistsOnMountPoint("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
+			users, err := getMountPointUsers("mountPoint", mountPoint, logs.GetLogger(), fakeExecutor)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(users).To(BeEmpty())
 		})
 	})
 	Context(".checkMountPointIsMounted", func() {
@@ -153,5 +432,120 @@ var _ = Describe("controller_internal_tests", func() {
 			Expect(res).To(BeFalse())
 		})
 	})
-})
+	Context(".doWaitForAttach", func() {
+		var (
+			fakeExecutor *fakes.FakeExecutor
+			fakeClient   *fakes.FakeStorageClient
+			controller   *Controller
+		)
+		BeforeEach(func() {
+			fakeExecutor = new(fakes.FakeExecutor)
+			fakeClient = new(fakes.FakeStorageClient)
+			controller = NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, fakeClient, fakeExecutor, new(fakes.FakeMounterFactory), volumeMetadataDir)
+			controller.waitForAttachTimeout = 0
+		})
+		It("should fail with timeout error if the multipath device never shows up", func() {
+			fakeExecutor.StatReturns(nil, fmt.Errorf("not exist"))
+			fakeExecutor.IsNotExistReturns(true)
+			request := k8sresources.FlexVolumeWaitForAttachRequest{Opts: map[string]string{"volumeName": "pv1", "Wwn": "fake"}}
+			res, err := controller.doWaitForAttach(request, "pv1")
+			Expect(err).To(Equal(&WaitForAttachTimeoutError{VolumeName: "pv1", Wwn: "fake", Timeout: 0}))
+			Expect(res).To(Equal(""))
+			Expect(fakeExecutor.StatCallCount()).To(Equal(1))
+		})
+		It("should rescan once and then poll until the multipath device shows up", func() {
+			controller.waitForAttachTimeout = time.Minute
+			controller.waitForAttachInterval = time.Millisecond
+			fakeExecutor.StatReturnsOnCall(0, nil, fmt.Errorf("not exist"))
+			fakeExecutor.StatReturnsOnCall(1, nil, fmt.Errorf("not exist"))
+			fakeExecutor.StatReturnsOnCall(2, nil, nil)
+			fakeExecutor.IsNotExistReturns(true)
+			fakeExecutor.EvalSymlinksReturns("/dev/dm-3", nil)
+			request := k8sresources.FlexVolumeWaitForAttachRequest{Opts: map[string]string{"volumeName": "pv1", "Wwn": "fake"}}
+			res, err := controller.doWaitForAttach(request, "pv1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal("/dev/dm-3"))
+			Expect(fakeExecutor.StatCallCount()).To(Equal(3))
+			// One rescan-scsi-bus and one multipath
+			Expect(fakeExecutor.ExecuteCallCount()).To(Equal(2))
+		})
+		It("should fail if the wwn is missing both in the request and in the volume config", func() {
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{}, nil)
+			request := k8sresources.FlexVolumeWaitForAttachRequest{Opts: map[string]string{"volumeName": "pv1"}}
+			_, err := controller.doWaitForAttach(request, "pv1")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(MissingWwnMountRequestErrorStr))
+			Expect(fakeExecutor.StatCallCount()).To(Equal(0))
+		})
+	})
+	Context(".recordPodEvent", func() {
+		var (
+			c              *Controller
+			fakeKubeClient *k8sfake.Clientset
+		)
+		BeforeEach(func() {
+			hostname, err := os.Hostname()
+			Expect(err).NotTo(HaveOccurred())
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "ns1", UID: "1f94f1d9-8f36-11e8-b227-005056a4d4cb"}, Spec: v1.PodSpec{NodeName: hostname}}
+			fakeKubeClient = k8sfake.NewSimpleClientset(pod)
+			c = NewControllerWithClient(nil, resources.UbiquityPluginConfig{}, new(fakes.FakeStorageClient), new(fakes.FakeExecutor), new(fakes.FakeMounterFactory), volumeMetadataDir)
+			c.kubeClient = fakeKubeClient
+		})
+		It("should record a warning event on the pod", func() {
+			c.recordPodEvent("ns1", "pod1", "1f94f1d9-8f36-11e8-b227-005056a4d4cb", ReasonMountFailed, "mount error")
+
+			events, err := fakeKubeClient.CoreV1().Events("ns1").List(metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.Items).To(HaveLen(1))
+			Expect(events.Items[0].InvolvedObject.Name).To(Equal("pod1"))
+			Expect(events.Items[0].Reason).To(Equal(ReasonMountFailed))
+			Expect(events.Items[0].Message).To(Equal("mount error"))
+			Expect(events.Items[0].Type).To(Equal(v1.EventTypeWarning))
+		})
+		It("should find the pod of the k8s mountpoint by its uid among the pods of the node", func() {
+			hostname, err := os.Hostname()
+			Expect(err).NotTo(HaveOccurred())
+
+			c.recordPodEventByMountPath("/var/lib/kubelet/pods/1f94f1d9-8f36-11e8-b227-005056a4d4cb/volumes/ibm~ubiquity-k8s-flex/pvc-123", ReasonUnmountFailed, "unmount error")
+
+			listAction, ok := fakeKubeClient.Actions()[0].(testcore.ListAction)
+			Expect(ok).To(BeTrue())
+			Expect(listAction.GetResource().Resource).To(Equal("pods"))
+			Expect(listAction.GetListRestrictions().Fields.String()).To(Equal("spec.nodeName=" + hostname))
+			events, err := fakeKubeClient.CoreV1().Events("ns1").List(metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.Items).To(HaveLen(1))
+			Expect(events.Items[0].InvolvedObject.Name).To(Equal("pod1"))
+			Expect(events.Items[0].Reason).To(Equal(ReasonUnmountFailed))
+		})
+		It("should not list the pods if the k8s mountpoint is not of a pod", func() {
+			c.recordPodEventByMountPath("/var/lib/kubelet/plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts/pvc-123", ReasonUnmountFailed, "unmount error")
+
+			Expect(fakeKubeClient.Actions()).To(HaveLen(0))
+		})
+		It("should record the mount failure on the pod of the mount request", func() {
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: "/tmp/mnt", MountDevice: "pv1", Version: k8sresources.KubernetesVersion_1_5, Opts: map[string]string{
+				k8sresources.OptionNameForPodName:      "pod1",
+				k8sresources.OptionNameForPodNamespace: "ns1",
+			}}
+
+			response := c.Mount(mountRequest)
 
+			Expect(response.Status).To(Equal(FlexFailureStr))
+			events, err := fakeKubeClient.CoreV1().Events("ns1").List(metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.Items).To(HaveLen(1))
+			Expect(events.Items[0].Reason).To(Equal(ReasonMountFailed))
+			Expect(events.Items[0].Message).To(Equal(response.Message))
+		})
+		It("should not record events without a kubernetes client", func() {
+			c.kubeClient = nil
+
+			c.recordPodEvent("ns1", "pod1", "", ReasonMountFailed, "mount error")
+
+			events, err := fakeKubeClient.CoreV1().Events("ns1").List(metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.Items).To(HaveLen(0))
+		})
+	})
+})
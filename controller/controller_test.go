@@ -22,6 +22,8 @@ import (
 
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 
 	ctl "github.com/IBM/ubiquity-k8s/controller"
 	k8sresources "github.com/IBM/ubiquity-k8s/resources"
@@ -40,14 +42,18 @@ var _ = Describe("Controller", func() {
 		ubiquityConfig     resources.UbiquityPluginConfig
 		dat                map[string]interface{}
 		mountPoint         string
+		volumeMetadataDir  string
 	)
 	BeforeEach(func() {
+		var err error
+		volumeMetadataDir, err = ioutil.TempDir("", "ubiquity-k8s-flex-volumes")
+		Expect(err).NotTo(HaveOccurred())
 		fakeExec = new(fakes.FakeExecutor)
 		ubiquityConfig = resources.UbiquityPluginConfig{}
 		fakeClient = new(fakes.FakeStorageClient)
 		fakeMounterFactory = new(fakes.FakeMounterFactory)
 		fakeMounter = new(fakes.FakeMounter)
-		controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+		controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 		byt := []byte(`{"Wwn":"fake"}`)
 		if err := json.Unmarshal(byt, &dat); err != nil {
 			panic(err)
@@ -55,6 +61,9 @@ var _ = Describe("Controller", func() {
 		mountPoint = "/tmp/kubelet/pods/1f94f1d9-8f36-11e8-b227-005056a4d4cb/volumes/ibm~ubiquity-k8s-flex/pvc-123"
 
 	})
+	AfterEach(func() {
+		os.RemoveAll(volumeMetadataDir)
+	})
 
 	Context(".Init", func() {
 
@@ -85,6 +94,15 @@ var _ = Describe("Controller", func() {
 				Expect(attachResponse.Status).To(Equal("Not supported"))
 				Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
 			})
+
+			It("Attach should fail for unknown backend", func() {
+				fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "fake", Mountpoint: "fake"}, nil)
+				AttachRequest := k8sresources.FlexVolumeAttachRequest{"vol1", "fakehost", map[string]string{}, "version", resources.RequestContext{}}
+				attachResponse := controller.Attach(AttachRequest)
+				Expect(attachResponse.Status).To(Equal(ctl.FlexFailureStr))
+				Expect(attachResponse.Message).To(MatchRegexp(ctl.PvBackendNotSupportedErrorStr))
+				Expect(fakeClient.AttachCallCount()).To(Equal(0))
+			})
 		})
 
 		//Context(".Attach", func() {
@@ -147,7 +165,7 @@ var _ = Describe("Controller", func() {
 		BeforeEach(func(){
 			extraParams = make(map[string]interface{})
 			extraParams["pv"] = "volume_name"
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 		})
 		It("should fail if k8s version < 1.6 (doMount)", func() {
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: "fake", MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_5}
@@ -173,7 +191,7 @@ var _ = Describe("Controller", func() {
 			errstr := "ERROR backend"
 			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "XXX", Mountpoint: "fake"}, nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, fmt.Errorf(errstr))
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{}}
 
 			mountResponse := controller.Mount(mountRequest)
@@ -277,7 +295,7 @@ var _ = Describe("Controller", func() {
 			fakeClient.GetVolumeConfigReturns(dat, nil)
 			fakeMounter.MountReturns("fake device", fmt.Errorf(errstr))
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}}
 
 			mountResponse := controller.Mount(mountRequest)
@@ -297,24 +315,25 @@ var _ = Describe("Controller", func() {
 			fakeClient.GetVolumeConfigReturns(dat, nil)
 			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			fakeExec.LstatReturns(nil, errstrObj)
 			fakeExec.IsNotExistReturns(false)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(2))
+			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(3))
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 			Expect(fakeExec.LstatCallCount()).To(Equal(1))
 			Expect(fakeExec.IsNotExistCallCount()).To(Equal(1))
 			Expect(fakeExec.IsNotExistArgsForCall(0)).To(Equal(errstrObj))
 			Expect(fakeExec.IsDirCallCount()).To(Equal(0))
-			Expect(mountResponse.Message).To(Equal(errstr))
+			Expect(mountResponse.Message).To(HaveSuffix(errstr))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
 		})
-		It("should fail to Mount k8s-mountpoint dir not exist(idempotent) but and failed to slink (doAfterMount)", func() {
+		It("should fail to Mount k8s-mountpoint dir not exist(idempotent) and failed to create it (doAfterMount)", func() {
 			errstr := "fakerror"
 			errstrObj := fmt.Errorf(errstr)
 
@@ -322,25 +341,46 @@ var _ = Describe("Controller", func() {
 			fakeClient.GetVolumeConfigReturns(dat, nil)
 			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			fakeExec.LstatReturns(nil, errstrObj)
 			fakeExec.IsNotExistReturns(true)
-			fakeExec.SymlinkReturns(errstrObj)
+			fakeExec.MkdirAllReturns(errstrObj)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 			Expect(fakeExec.LstatCallCount()).To(Equal(1))
-			Expect(fakeExec.IsNotExistCallCount()).To(Equal(1))
-			Expect(fakeExec.IsNotExistArgsForCall(0)).To(Equal(errstrObj))
-			Expect(fakeExec.IsDirCallCount()).To(Equal(0))
-			Expect(mountResponse.Message).To(Equal(errstr))
+			Expect(fakeExec.MkdirAllCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(0))
+			Expect(mountResponse.Message).To(HaveSuffix(errstr))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should fail to Mount k8s-mountpoint dir not exist(idempotent) and bind mount failed (doAfterMount)", func() {
+			errstr := "fakerror"
+			errstrObj := fmt.Errorf(errstr)
+
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, errstrObj)
+			fakeExec.IsNotExistReturns(true)
+			fakeExec.ExecuteReturns(nil, errstrObj)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(fakeExec.MkdirAllCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			Expect(mountResponse.Message).To(HaveSuffix(errstr))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
 		})
-		It("should succeed to Mount k8s-mountpoint dir not exist(idempotent) and slink succeed (doAfterMount)", func() {
+		It("should succeed to Mount k8s-mountpoint dir not exist(idempotent) and bind mount succeed (doAfterMount)", func() {
 			errstr := "fakerror"
 			errstrObj := fmt.Errorf(errstr)
 
@@ -349,10 +389,9 @@ var _ = Describe("Controller", func() {
 			mountpoint := "/ubiquity/wwn1"
 			fakeMounter.MountReturns(mountpoint, nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			fakeExec.LstatReturns(nil, errstrObj)
 			fakeExec.IsNotExistReturns(true)
-			fakeExec.SymlinkReturns(nil)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 
 			mountResponse := controller.Mount(mountRequest)
@@ -362,96 +401,283 @@ var _ = Describe("Controller", func() {
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
 			Expect(fakeExec.LstatCallCount()).To(Equal(1))
 			Expect(fakeExec.IsNotExistCallCount()).To(Equal(1))
-			Expect(fakeExec.SymlinkCallCount()).To(Equal(1))
+			Expect(fakeExec.MkdirAllCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			cmd, args := fakeExec.ExecuteArgsForCall(0)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"--bind", mountpoint, mountPoint}))
+			Expect(fakeExec.SymlinkCallCount()).To(Equal(0))
 			Expect(fakeExec.IsDirCallCount()).To(Equal(0))
 			Expect(mountResponse.Message).To(Equal(""))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
 			Expect(mountResponse.Device).To(Equal(""))
 		})
-		It("should fail to Mount because fail to Remove the k8s-mountpoint dir (doAfterMount)", func() {
-			errstr := "fakerror"
-			errstrObj := fmt.Errorf(errstr)
+		It("should keep the global mountpoint read-write and remount only the k8s-mountpoint as read-only (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"Wwn": "fake"}, nil)
+			mountpoint := "/ubiquity/wwn1"
+			fakeMounter.MountReturns(mountpoint, nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake", k8sresources.OptionNameForReadWrite: k8sresources.OptionValueReadOnly}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.MountArgsForCall(0).VolumeConfig).To(Equal(map[string]interface{}{"Wwn": "fake"}))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(2))
+			cmd, args := fakeExec.ExecuteArgsForCall(0)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"--bind", mountpoint, mountPoint}))
+			cmd, args = fakeExec.ExecuteArgsForCall(1)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"-o", "remount,bind,ro", mountPoint}))
+			Expect(mountResponse.Message).To(Equal(""))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should pass the fsType of the PV to the mounter (doMount)", func() {
+			volumeConfig := map[string]interface{}{"Wwn": "fake"}
 			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
-			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeClient.GetVolumeConfigReturns(volumeConfig, nil)
 			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
-			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
-			fakeExec.LstatReturns(nil, nil)
-			fakeExec.IsDirReturns(true)
-			fakeExec.RemoveReturns(errstrObj)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			opts := map[string]string{"Wwn": "fake", k8sresources.OptionNameForFsType: "xfs"}
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: opts, Version: k8sresources.KubernetesVersion_1_6OrLater}
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
-			Expect(fakeMounter.MountCallCount()).To(Equal(1))
-			Expect(fakeExec.LstatCallCount()).To(Equal(1))
-			Expect(fakeExec.IsNotExistCallCount()).To(Equal(0))
-			Expect(fakeExec.IsDirCallCount()).To(Equal(1))
-			Expect(fakeExec.RemoveCallCount()).To(Equal(1))
-			Expect(fakeExec.SymlinkCallCount()).To(Equal(0))
-			Expect(mountResponse.Message).To(MatchRegexp(ctl.FailRemovePVorigDirErrorStr))
+			mounterVolumeConfig := fakeMounter.MountArgsForCall(0).VolumeConfig
+			Expect(mounterVolumeConfig).To(Equal(map[string]interface{}{"Wwn": "fake", k8sresources.VolumeConfigFsTypeKey: "xfs"}))
+			Expect(volumeConfig).NotTo(HaveKey(k8sresources.VolumeConfigFsTypeKey))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should remount the mountpoint with the mountOptions of the PV before the bind mount (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"Wwn": "fake"}, nil)
+			mountpoint := "/ubiquity/wwn1"
+			fakeMounter.MountReturns(mountpoint, nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			opts := map[string]string{"Wwn": "fake", k8sresources.OptionNameForMountOptions: "noatime, nodiratime"}
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: opts, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeMounter.MountArgsForCall(0).VolumeConfig).To(Equal(map[string]interface{}{"Wwn": "fake"}))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(2))
+			cmd, args := fakeExec.ExecuteArgsForCall(0)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"-o", "remount,noatime,nodiratime", mountpoint}))
+			cmd, args = fakeExec.ExecuteArgsForCall(1)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"--bind", mountpoint, mountPoint}))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should skip the mountOptions if the backend mountpoint is not a mount (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SpectrumScale, Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"mountpoint": "/gpfs/fs1/fileset1"}, nil)
+			fakeMounter.MountReturns("/gpfs/fs1/fileset1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			opts := map[string]string{k8sresources.OptionNameForMountOptions: "noatime"}
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: opts, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			cmd, args := fakeExec.ExecuteArgsForCall(0)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"--bind", "/gpfs/fs1/fileset1", mountPoint}))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should roll back the mount if the remount with the mountOptions failed (doAfterMount)", func() {
+			errstr := "fakerror"
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"Wwn": "fake", resources.ScbeKeyVolAttachToHost: "host1"}, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.ExecuteReturns(nil, fmt.Errorf(errstr))
+			opts := map[string]string{"Wwn": "fake", k8sresources.OptionNameForMountOptions: "noatime"}
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: opts, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			Expect(fakeExec.LstatCallCount()).To(Equal(0))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(mountResponse.Message).To(Equal(ctl.MountRollbackSucceededMsg + errstr))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
 		})
-		It("should fail to Mount because fail to create Symlink after Remove the k8s-mountpoint dir (doAfterMount)", func() {
+		It("should not remount the k8s-mountpoint for a read-write mount (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"Wwn": "fake"}, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake", k8sresources.OptionNameForReadWrite: "rw"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should unbind the k8s-mountpoint and fail if the read-only remount failed (doAfterMount)", func() {
 			errstr := "fakerror"
-			errstrObj := fmt.Errorf(errstr)
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"Wwn": "fake"}, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			fakeExec.ExecuteReturnsOnCall(1, nil, fmt.Errorf(errstr))
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake", k8sresources.OptionNameForReadWrite: k8sresources.OptionValueReadOnly}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
 
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(3))
+			cmd, args := fakeExec.ExecuteArgsForCall(2)
+			Expect(cmd).To(Equal("umount"))
+			Expect(args).To(Equal([]string{mountPoint}))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(mountResponse.Message).To(HaveSuffix(errstr))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should apply the fsGroup ownership on the mountpoint after the bind mount (doAfterMount)", func() {
 			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
 			fakeClient.GetVolumeConfigReturns(dat, nil)
+			mountpoint := "/ubiquity/wwn1"
+			fakeMounter.MountReturns(mountpoint, nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake", k8sresources.OptionNameForFsGroup: "2000"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(4))
+			cmd, args := fakeExec.ExecuteArgsForCall(1)
+			Expect(cmd).To(Equal("chgrp"))
+			Expect(args).To(Equal([]string{"-R", "2000", mountpoint}))
+			cmd, args = fakeExec.ExecuteArgsForCall(2)
+			Expect(cmd).To(Equal("chmod"))
+			Expect(args).To(Equal([]string{"-R", "g+rwX", mountpoint}))
+			cmd, args = fakeExec.ExecuteArgsForCall(3)
+			Expect(cmd).To(Equal("chmod"))
+			Expect(args).To(Equal([]string{"g+s", mountpoint}))
+			Expect(mountResponse.Message).To(Equal(""))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should fail to Mount if the fsGroup is not numeric (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake", k8sresources.OptionNameForFsGroup: "group1"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			Expect(mountResponse.Message).To(MatchRegexp(ctl.InvalidFsGroupErrorStr))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should not apply the fsGroup ownership on a read-only mount (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"Wwn": "fake"}, nil)
 			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake", k8sresources.OptionNameForFsGroup: "2000", k8sresources.OptionNameForReadWrite: k8sresources.OptionValueReadOnly}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(2))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should succeed to Mount when k8s-mountpoint dir exist and not mounted, by bind mount into it (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			mountpoint := "/ubiquity/wwn1"
+			fakeMounter.MountReturns(mountpoint, nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 			fakeExec.LstatReturns(nil, nil)
 			fakeExec.IsDirReturns(true)
-			fakeExec.RemoveReturns(nil)
-			fakeExec.SymlinkReturns(errstrObj)
+			fakeExec.GetDeviceForFileStatReturns(12)
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
-			Expect(fakeExec.LstatCallCount()).To(Equal(1))
-			Expect(fakeExec.IsNotExistCallCount()).To(Equal(0))
 			Expect(fakeExec.IsDirCallCount()).To(Equal(1))
-			Expect(fakeExec.RemoveCallCount()).To(Equal(1))
-			Expect(fakeExec.SymlinkCallCount()).To(Equal(1))
-			Expect(fakeExec.IsSlinkCallCount()).To(Equal(0))
-			Expect(mountResponse.Message).To(MatchRegexp(errstr))
-			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(fakeExec.RemoveCallCount()).To(Equal(0))
+			Expect(fakeExec.SymlinkCallCount()).To(Equal(0))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			cmd, args := fakeExec.ExecuteArgsForCall(0)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"--bind", mountpoint, mountPoint}))
+			Expect(mountResponse.Message).To(Equal(""))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
 		})
-
-		It("should fail to Mount because fail to create Symlink after Remove the k8s-mountpoint dir (doAfterMount)", func() {
+		It("should succeed to Mount when k8s-mountpoint dir is already mounted to the right mountpoint (idempotent) (doAfterMount)", func() {
 			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
 			fakeClient.GetVolumeConfigReturns(dat, nil)
 			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 			fakeExec.LstatReturns(nil, nil)
 			fakeExec.IsDirReturns(true)
-			fakeExec.RemoveReturns(nil)
-			fakeExec.SymlinkReturns(nil)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+			fakeExec.IsSameFileReturns(true)
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
-			Expect(fakeExec.LstatCallCount()).To(Equal(1))
-			Expect(fakeExec.IsNotExistCallCount()).To(Equal(0))
-			Expect(fakeExec.IsDirCallCount()).To(Equal(1))
-			Expect(fakeExec.RemoveCallCount()).To(Equal(1))
-			Expect(fakeExec.SymlinkCallCount()).To(Equal(1))
-			Expect(fakeExec.IsSlinkCallCount()).To(Equal(0))
+			Expect(fakeExec.IsSameFileCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(0))
 			Expect(mountResponse.Message).To(Equal(""))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
 		})
+		It("should fail to Mount when k8s-mountpoint dir is already mounted to a wrong mountpoint (idempotent) (doAfterMount)", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+			fakeExec.LstatReturns(nil, nil)
+			fakeExec.IsDirReturns(true)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+			fakeExec.IsSameFileReturns(false)
+
+			mountResponse := controller.Mount(mountRequest)
 
+			Expect(fakeExec.IsSameFileCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(0))
+			Expect(mountResponse.Message).To(MatchRegexp(ctl.K8sPVDirectoryIsMountedToWrongMountpointErrorStr))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
+		})
 		It("should fail to Mount because fail to EvalSymlinks (idempotent) (doAfterMount)", func() {
 			errstr := "fakerror"
 			errstrObj := fmt.Errorf(errstr)
@@ -460,7 +686,7 @@ var _ = Describe("Controller", func() {
 			fakeClient.GetVolumeConfigReturns(dat, nil)
 			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 			fakeExec.LstatReturns(nil, nil)
 			fakeExec.IsDirReturns(false)
@@ -469,15 +695,16 @@ var _ = Describe("Controller", func() {
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(2))
+			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(3))
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 			Expect(fakeExec.LstatCallCount()).To(Equal(1))
 			Expect(fakeExec.IsNotExistCallCount()).To(Equal(0))
 			Expect(fakeExec.IsDirCallCount()).To(Equal(1))
 			Expect(fakeExec.IsSlinkCallCount()).To(Equal(1))
 			Expect(fakeExec.EvalSymlinksCallCount()).To(Equal(1))
-			Expect(mountResponse.Message).To(Equal(errstr))
+			Expect(mountResponse.Message).To(HaveSuffix(errstr))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
 		})
 		It("should succeed to Mount after k8s-mountpoint is already slink(idempotent) and point to the right mountpath (doAfterMount)", func() {
@@ -487,7 +714,7 @@ var _ = Describe("Controller", func() {
 
 			fakeMounter.MountReturns(mountPath, nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 			fakeExec.LstatReturns(nil, nil)
 			fakeExec.IsDirReturns(false)
@@ -504,6 +731,7 @@ var _ = Describe("Controller", func() {
 			Expect(fakeExec.IsDirCallCount()).To(Equal(1))
 			Expect(fakeExec.IsSlinkCallCount()).To(Equal(1))
 			Expect(fakeExec.EvalSymlinksCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(0))
 			Expect(mountResponse.Message).To(Equal(""))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
 			Expect(mountResponse.Device).To(Equal(""))
@@ -516,7 +744,7 @@ var _ = Describe("Controller", func() {
 
 			fakeMounter.MountReturns(mountPath, nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 			fakeExec.LstatReturns(nil, nil)
 			fakeExec.IsDirReturns(false)
@@ -526,9 +754,10 @@ var _ = Describe("Controller", func() {
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(2))
+			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(3))
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 			Expect(fakeExec.LstatCallCount()).To(Equal(1))
 			Expect(fakeExec.IsNotExistCallCount()).To(Equal(0))
 			Expect(fakeExec.IsDirCallCount()).To(Equal(1))
@@ -544,7 +773,7 @@ var _ = Describe("Controller", func() {
 
 			fakeMounter.MountReturns(mountPath, nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 			fakeExec.LstatReturns(nil, nil)
 			fakeExec.IsDirReturns(false)
@@ -552,9 +781,10 @@ var _ = Describe("Controller", func() {
 
 			mountResponse := controller.Mount(mountRequest)
 
-			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
-			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(2))
+			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(3))
 			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 			Expect(fakeExec.LstatCallCount()).To(Equal(1))
 			Expect(fakeExec.IsNotExistCallCount()).To(Equal(0))
 			Expect(fakeExec.IsDirCallCount()).To(Equal(1))
@@ -563,17 +793,93 @@ var _ = Describe("Controller", func() {
 			Expect(mountResponse.Message).To(MatchRegexp(ctl.K8sPVDirectoryIsNotDirNorSlinkErrorStr))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
 		})
-		It("should fail to Mount when there are errors from checking other slinks (idempotent) (doMount)", func() {
-			err :=  fmt.Errorf("an Error has occured")
-			fakeExec.GetGlobFilesReturns(nil, err)
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+		It("should mount the same volume for a second pod on the node without failing (doMount)", func() {
 			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.GetGlobFilesReturns([]string{"/tmp/kubelet/pods/other-pod/volumes/ibm~ubiquity-k8s-flex/pvc-123"}, nil)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
 			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
 
 			mountResponse := controller.Mount(mountRequest)
-			Expect(mountResponse.Message).To(Equal(err.Error()))
+
+			Expect(fakeExec.GetGlobFilesCallCount()).To(Equal(0))
+			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			Expect(mountResponse.Message).To(Equal(""))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should not roll back the mount if another pod uses the mountpoint when bind mount failed (doAfterMount)", func() {
+			errstr := "fakerror"
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			fakeExec.ExecuteReturns(nil, fmt.Errorf(errstr))
+			fakeExec.GetGlobFilesReturnsOnCall(0, []string{"/tmp/kubelet/pods/other-pod/volumes/ibm~ubiquity-k8s-flex/pvc-123"}, nil)
+			fakeExec.GetGlobFilesReturnsOnCall(1, []string{}, nil)
+			fakeExec.IsSameFileReturns(true)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(0))
+			Expect(fakeClient.DetachCallCount()).To(Equal(0))
+			Expect(mountResponse.Message).To(Equal(ctl.MountRollbackSucceededMsg + errstr))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should roll back the mount by unmount and legacy detach if bind mount failed (doAfterMount)", func() {
+			errstr := "fakerror"
+			volumeConfig := map[string]interface{}{"Wwn": "fake", resources.ScbeKeyVolAttachToHost: "host1"}
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(volumeConfig, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			fakeExec.ExecuteReturns(nil, fmt.Errorf(errstr))
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountArgsForCall(0).VolumeConfig).To(Equal(volumeConfig))
+			Expect(fakeClient.DetachCallCount()).To(Equal(1))
+			Expect(fakeClient.DetachArgsForCall(0).Host).To(Equal("host1"))
+			Expect(fakeMounter.ActionAfterDetachCallCount()).To(Equal(1))
+			Expect(mountResponse.Message).To(Equal(ctl.MountRollbackSucceededMsg + errstr))
+			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should report the rollback failure if mounter.Unmount failed during the rollback (doAfterMount)", func() {
+			errstr := "fakerror"
+			unmountErr := fmt.Errorf("unmount error")
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "scbe", Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounter.MountReturns("/ubiquity/wwn1", nil)
+			fakeMounter.UnmountReturns(unmountErr)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			fakeExec.ExecuteReturns(nil, fmt.Errorf(errstr))
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+
+			mountResponse := controller.Mount(mountRequest)
+
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(fakeMounter.ActionAfterDetachCallCount()).To(Equal(0))
+			Expect(mountResponse.Message).To(Equal(fmt.Sprintf(ctl.MountRollbackFailedMsg, unmountErr) + errstr))
 			Expect(mountResponse.Status).To(Equal(ctl.FlexFailureStr))
-			Expect(fakeExec.GetGlobFilesCallCount()).To(Equal(1))
 		})
 	})
 	Context(".Unmount", func() {
@@ -601,7 +907,7 @@ var _ = Describe("Controller", func() {
 			errstr := "ERROR backend"
 			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "XXX", Mountpoint: "fake"}, nil)
 			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, fmt.Errorf(errstr))
-			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+			controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 			unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/k8s-dir-pod/pv1"}
 
 			response := controller.Unmount(unmountRequest)
@@ -652,38 +958,31 @@ var _ = Describe("Controller", func() {
 			Expect(response.Message).To(MatchRegexp(ctl.PvBackendNotSupportedErrorStr))
 			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 		})
-		Context(".Unmount checkSlinkBeforeUmount", func() {
+		Context(".Unmount removeK8sPVDirectory", func() {
 			var (
 				errstrObj error
 				errstr    string
-				wwn       string
 			)
 			BeforeEach(func() {
 				errstr = "fakerror"
 				errstrObj = fmt.Errorf(errstr)
 				fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE, Mountpoint: "fake"}, nil)
-				wwn = "fake"
-				byt := []byte(`{"Wwn":"fake"}`) // TODO should use the wwn var inside
-
-				var dat map[string]interface{}
-				if err := json.Unmarshal(byt, &dat); err != nil {
-					panic(err)
-				}
 				fakeClient.GetVolumeConfigReturns(dat, nil)
+				fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
 			})
 			AfterEach(func() {
 				Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
 				Expect(fakeMounterFactory.GetMounterPerBackendCallCount()).To(Equal(1))
 				Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(1))
 				Expect(fakeMounter.UnmountCallCount()).To(Equal(0))
-				Expect(fakeExec.LstatCallCount()).To(Equal(1))
+				Expect(fakeExec.LstatCallCount()).To(BeNumerically(">=", 1))
 			})
 
 			// Start with all the failures in this function
-			It("should fail because slink lstat error diff from not exist", func() {
+			It("should fail because k8s-mountpoint lstat error diff from not exist", func() {
 				fakeExec.LstatReturns(nil, errstrObj)
 				fakeExec.IsNotExistReturns(false)
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
@@ -695,46 +994,97 @@ var _ = Describe("Controller", func() {
 				fakeExec.LstatReturns(nil, nil)
 				fakeExec.IsSlinkReturns(true)
 				fakeExec.EvalSymlinksReturns("", errstrObj)
-
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
 				Expect(fakeExec.IsSlinkCallCount()).To(Equal(1))
 				Expect(fakeExec.EvalSymlinksCallCount()).To(Equal(1))
+				Expect(fakeExec.RemoveCallCount()).To(Equal(0))
 				Expect(response.Message).To(MatchRegexp(errstr))
 				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 			})
-			It("should fail because its an real slink but cannot eval it", func() {
+			It("should fail because its an real slink but point to a wrong mountpoint", func() {
 				fakeExec.LstatReturns(nil, nil)
 				fakeExec.IsSlinkReturns(true)
 				fakeExec.EvalSymlinksReturns("/fake/evalOfSlink", nil)
-
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
 				Expect(fakeExec.IsSlinkCallCount()).To(Equal(1))
 				Expect(fakeExec.EvalSymlinksCallCount()).To(Equal(1))
+				Expect(fakeExec.RemoveCallCount()).To(Equal(0))
 				Expect(response.Message).To(MatchRegexp(ctl.WrongSlinkErrorStr))
 				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 			})
-			It("should fail because slink exist but its not slink", func() {
+			It("should fail because k8s-mountpoint exist but its not dir nor slink", func() {
 				fakeExec.LstatReturns(nil, nil)
 				fakeExec.IsSlinkReturns(false)
-
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				fakeExec.IsDirReturns(false)
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
 				Expect(fakeExec.IsSlinkCallCount()).To(Equal(1))
 				Expect(fakeExec.EvalSymlinksCallCount()).To(Equal(0))
-				Expect(response.Message).To(MatchRegexp(ctl.K8sPVDirectoryIsNotSlinkErrorStr))
+				Expect(response.Message).To(MatchRegexp(ctl.K8sPVDirectoryIsNotDirNorSlinkErrorStr))
 				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 			})
+			It("should fail because the unbind of the k8s-mountpoint failed", func() {
+				fakeExec.LstatReturns(nil, nil)
+				fakeExec.IsDirReturns(true)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+				fakeExec.ExecuteReturns(nil, errstrObj)
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
+
+				response := controller.Unmount(unmountRequest)
+
+				Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+				cmd, args := fakeExec.ExecuteArgsForCall(0)
+				Expect(cmd).To(Equal("umount"))
+				Expect(args).To(Equal([]string{mountPoint}))
+				Expect(fakeExec.RemoveCallCount()).To(Equal(0))
+				Expect(response.Message).To(MatchRegexp(errstr))
+				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			})
+			It("should fail because the removal of the k8s-mountpoint failed", func() {
+				fakeExec.LstatReturns(nil, nil)
+				fakeExec.IsDirReturns(true)
+				fakeExec.RemoveReturns(errstrObj)
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
+
+				response := controller.Unmount(unmountRequest)
+
+				Expect(fakeExec.ExecuteCallCount()).To(Equal(0))
+				Expect(fakeExec.RemoveCallCount()).To(Equal(1))
+				Expect(response.Message).To(MatchRegexp(errstr))
+				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			})
+			It("should skip mounter.Unmount and detach if other pods still use the mountpoint", func() {
+				otherPodDir := "/tmp/kubelet/pods/other-pod/volumes/ibm~ubiquity-k8s-flex/pvc-123"
+				fakeExec.LstatReturns(nil, nil)
+				fakeExec.IsDirReturns(true)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(2, 12)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(3, 15)
+				fakeExec.GetGlobFilesReturnsOnCall(0, []string{mountPoint, otherPodDir}, nil)
+				fakeExec.GetGlobFilesReturnsOnCall(1, []string{}, nil)
+				fakeExec.IsSameFileReturns(true)
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
+
+				response := controller.Unmount(unmountRequest)
 
+				Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+				Expect(fakeExec.RemoveCallCount()).To(Equal(1))
+				Expect(fakeClient.DetachCallCount()).To(Equal(0))
+				Expect(response.Message).To(Equal(""))
+				Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+			})
 		})
-		Context(".Unmount checkSlinkBeforeUmount succeed with slink exist - so check slink removal and mounter.Mount", func() {
+		Context(".Unmount removeK8sPVDirectory succeed - so check mounter.Unmount", func() {
 			var (
 				errstrObj error
 				errstr    string
@@ -745,15 +1095,10 @@ var _ = Describe("Controller", func() {
 				errstrObj = fmt.Errorf(errstr)
 				fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE, Mountpoint: "fake"}, nil)
 				wwn = "fake"
-				byt := []byte(`{"Wwn":"fake"}`) // TODO should use the wwn var inside
-
-				var dat map[string]interface{}
-				if err := json.Unmarshal(byt, &dat); err != nil {
-					panic(err)
-				}
 				fakeClient.GetVolumeConfigReturns(dat, nil)
 				fakeExec.LstatReturns(nil, nil)
 				fakeExec.IsSlinkReturns(true)
+				fakeExec.GetGlobFilesReturns([]string{}, nil)
 			})
 			AfterEach(func() {
 				Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
@@ -762,37 +1107,35 @@ var _ = Describe("Controller", func() {
 				Expect(fakeExec.LstatCallCount()).To(Equal(1))
 				Expect(fakeExec.IsSlinkCallCount()).To(Equal(1))
 				Expect(fakeExec.EvalSymlinksCallCount()).To(Equal(1))
-				Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 			})
 			It("should fail unmount because mounter.Unmount failed", func() {
 				fakeExec.EvalSymlinksReturns("/ubiquity/"+wwn, nil)
 				fakeMounter.UnmountReturns(errstrObj)
 				fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
-
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
+				Expect(fakeExec.RemoveCallCount()).To(Equal(1))
+				Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 				Expect(response.Message).To(MatchRegexp(errstr))
 				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 			})
 			It("should fail unmount because the removal of slink failed (reminder in this stage the slink exist so it fail due to a real issue of the rm)", func() {
 				fakeExec.EvalSymlinksReturns("/ubiquity/"+wwn, nil)
 				fakeExec.RemoveReturns(errstrObj)
-
 				fakeMounter.UnmountReturns(nil)
 				fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
+				Expect(fakeMounter.UnmountCallCount()).To(Equal(0))
 				Expect(response.Message).To(MatchRegexp(errstr))
 				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 			})
-			//TODO continue from here!!!!!!!!!!!! to add UT for slink not exist at all. and then continue the flow for after mounter.Unmount
-
 		})
 		Context(".Unmount check good path of doUnmount till hit the first error in doLegacyDetach", func() {
 			var (
@@ -805,17 +1148,11 @@ var _ = Describe("Controller", func() {
 				errstrObj = fmt.Errorf(errstr)
 				fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE, Mountpoint: "fake"}, nil)
 				wwn = "fake"
-				byt := []byte(`{"Wwn":"fake"}`) // TODO should use the wwn var inside
-
-				var dat map[string]interface{}
-				if err := json.Unmarshal(byt, &dat); err != nil {
-					panic(err)
-				}
 				fakeClient.GetVolumeConfigReturnsOnCall(0, dat, nil)
 				fakeClient.GetVolumeConfigReturnsOnCall(1, dat, errstrObj) // the first fail in doLegacyDetach
+				fakeExec.GetGlobFilesReturns([]string{}, nil)
 			})
 			AfterEach(func() {
-				fmt.Println("11111111111111111111")
 				Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
 				Expect(fakeMounterFactory.GetMounterPerBackendCallCount()).To(Equal(1))
 				Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(2)) // first in doUnmount and second is in the legacy
@@ -824,32 +1161,49 @@ var _ = Describe("Controller", func() {
 				fakeExec.EvalSymlinksReturns("/ubiquity/"+wwn, nil)
 				fakeMounter.UnmountReturns(nil)
 				fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
+				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
 				fakeExec.IsSlinkReturns(true)
 				fakeExec.LstatReturns(nil, nil)
-
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
 				Expect(fakeExec.LstatCallCount()).To(Equal(1))
 				Expect(fakeExec.EvalSymlinksCallCount()).To(Equal(1))
+				Expect(fakeExec.RemoveCallCount()).To(Equal(1))
 				Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
 				Expect(response.Message).To(MatchRegexp(errstr))
 				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 			})
-			It("should succeed doUnmount because slink not exist (no need to run mounter.Unmount) but then lets fail it during doLegacyDetach", func() {
-				fakeExec.EvalSymlinksReturns("/ubiquity/"+wwn, nil)
+			It("should succeed doUnmount with bind mounted dir (means doing umount and mounter.Unmount) but fail during doLegacyDetach", func() {
 				fakeMounter.UnmountReturns(nil)
 				fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
-				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory)
-				fakeExec.IsSlinkReturns(true)
-				fakeExec.LstatReturns(nil, fmt.Errorf("error because file not exist")) // simulate idempotent with no slink exist
-				fakeExec.IsNotExistReturns(true)                                       // simulate idempotent with no slink exist
-				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/pod/pv1"}
+				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+				fakeExec.LstatReturns(nil, nil)
+				fakeExec.IsDirReturns(true)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+				fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
 
 				response := controller.Unmount(unmountRequest)
 
+				Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+				Expect(fakeExec.RemoveCallCount()).To(Equal(1))
+				Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+				Expect(response.Message).To(MatchRegexp(errstr))
+				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			})
+			It("should succeed doUnmount because k8s-mountpoint not exist (idempotent) but then lets fail it during doLegacyDetach", func() {
+				fakeMounter.UnmountReturns(nil)
+				fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+				controller = ctl.NewControllerWithClient(testLogger, ubiquityConfig, fakeClient, fakeExec, fakeMounterFactory, volumeMetadataDir)
+				fakeExec.LstatReturns(nil, fmt.Errorf("error because file not exist")) // simulate idempotent with no k8s-mountpoint exist
+				fakeExec.IsNotExistReturns(true)                                       // simulate idempotent with no k8s-mountpoint exist
+				unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
+
+				response := controller.Unmount(unmountRequest)
+
+				Expect(fakeExec.RemoveCallCount()).To(Equal(0))
 				Expect(response.Message).To(MatchRegexp(errstr))
 				Expect(response.Status).To(Equal(ctl.FlexFailureStr))
 			})
@@ -858,6 +1212,136 @@ var _ = Describe("Controller", func() {
 		})
 
 	})
+	Context(".MountDevice", func() {
+		var deviceMountPath string
+		BeforeEach(func() {
+			deviceMountPath = "/tmp/kubelet/plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts/pv1"
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE, Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+		})
+		It("should fail since request options does not contain volume name", func() {
+			mountDeviceRequest := k8sresources.FlexVolumeMountDeviceRequest{Path: deviceMountPath, Opts: map[string]string{"Wwn": "fake"}}
+
+			response := controller.MountDevice(mountDeviceRequest)
+
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(0))
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should fail if mounter.Mount failed", func() {
+			errstr := "fakerror"
+			fakeMounter.MountReturns("", fmt.Errorf(errstr))
+			mountDeviceRequest := k8sresources.FlexVolumeMountDeviceRequest{Path: deviceMountPath, Opts: map[string]string{"volumeName": "pv1", "Wwn": "fake"}}
+
+			response := controller.MountDevice(mountDeviceRequest)
+
+			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(0))
+			Expect(response.Message).To(Equal(errstr))
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should mount the volume once and bind mount it to the device mount path", func() {
+			fakeMounter.MountReturns("/ubiquity/fake", nil)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			mountDeviceRequest := k8sresources.FlexVolumeMountDeviceRequest{Path: deviceMountPath, Opts: map[string]string{"volumeName": "pv1", "Wwn": "fake"}}
+
+			response := controller.MountDevice(mountDeviceRequest)
+
+			Expect(fakeClient.GetVolumeArgsForCall(0).Name).To(Equal("pv1"))
+			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+			Expect(fakeExec.MkdirAllCallCount()).To(Equal(1))
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			cmd, args := fakeExec.ExecuteArgsForCall(0)
+			Expect(cmd).To(Equal("mount"))
+			Expect(args).To(Equal([]string{"--bind", "/ubiquity/fake", deviceMountPath}))
+			Expect(response.Message).To(Equal(""))
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should unmount the volume but not detach it if the bind mount failed", func() {
+			errstr := "fakerror"
+			fakeMounter.MountReturns("/ubiquity/fake", nil)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			fakeExec.ExecuteReturns(nil, fmt.Errorf(errstr))
+			mountDeviceRequest := k8sresources.FlexVolumeMountDeviceRequest{Path: deviceMountPath, Opts: map[string]string{"volumeName": "pv1", "Wwn": "fake"}}
+
+			response := controller.MountDevice(mountDeviceRequest)
+
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(fakeMounter.ActionAfterDetachCallCount()).To(Equal(0))
+			Expect(fakeClient.DetachCallCount()).To(Equal(0))
+			Expect(response.Message).To(Equal(ctl.MountRollbackSucceededMsg + errstr))
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+		})
+	})
+	Context(".UnmountDevice", func() {
+		var deviceMountPath string
+		BeforeEach(func() {
+			deviceMountPath = "/tmp/kubelet/plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts/pv1"
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE, Mountpoint: "fake"}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+		})
+		It("should return success if the volume does not exist, idempotent issue", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{}, &resources.VolumeNotFoundError{VolName: "pv1"})
+			unmountDeviceRequest := k8sresources.FlexVolumeUnmountDeviceRequest{Name: deviceMountPath}
+
+			response := controller.UnmountDevice(unmountDeviceRequest)
+
+			Expect(fakeClient.GetVolumeArgsForCall(0).Name).To(Equal("pv1"))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(0))
+			Expect(response.Message).To(MatchRegexp(".*" + resources.VolumeNotFoundErrorMsg))
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should fail if GetVolume fails with error other than volume not found", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{}, fmt.Errorf("just error"))
+			unmountDeviceRequest := k8sresources.FlexVolumeUnmountDeviceRequest{Name: deviceMountPath}
+
+			response := controller.UnmountDevice(unmountDeviceRequest)
+
+			Expect(response.Message).To(MatchRegexp(".*just error"))
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+		})
+		It("should unbind the device mount path and unmount the volume if no other pod uses it", func() {
+			fakeExec.LstatReturns(nil, nil)
+			fakeExec.IsDirReturns(true)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+			fakeExec.GetGlobFilesReturns([]string{}, nil)
+			unmountDeviceRequest := k8sresources.FlexVolumeUnmountDeviceRequest{Name: deviceMountPath}
+
+			response := controller.UnmountDevice(unmountDeviceRequest)
+
+			Expect(fakeExec.ExecuteCallCount()).To(Equal(1))
+			cmd, args := fakeExec.ExecuteArgsForCall(0)
+			Expect(cmd).To(Equal("umount"))
+			Expect(args).To(Equal([]string{deviceMountPath}))
+			Expect(fakeExec.RemoveCallCount()).To(Equal(1))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(fakeClient.DetachCallCount()).To(Equal(0))
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+		It("should not unmount the volume if a pod still uses it", func() {
+			podDir := "/tmp/kubelet/pods/1f94f1d9-8f36-11e8-b227-005056a4d4cb/volumes/ibm~ubiquity-k8s-flex/pv1"
+			fakeExec.LstatReturns(nil, nil)
+			fakeExec.IsDirReturns(true)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(0, 12)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(1, 15)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(2, 12)
+			fakeExec.GetDeviceForFileStatReturnsOnCall(3, 15)
+			fakeExec.GetGlobFilesReturnsOnCall(0, []string{podDir}, nil)
+			fakeExec.GetGlobFilesReturnsOnCall(1, []string{deviceMountPath}, nil)
+			fakeExec.IsSameFileReturns(true)
+			unmountDeviceRequest := k8sresources.FlexVolumeUnmountDeviceRequest{Name: deviceMountPath}
+
+			response := controller.UnmountDevice(unmountDeviceRequest)
+
+			Expect(fakeExec.GetGlobFilesArgsForCall(1)).To(Equal("/tmp/kubelet/plugins/kubernetes.io/flexvolume/ibm/ubiquity-k8s-flex/mounts/*"))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(0))
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+		})
+	})
 
 	/*
 		Context(".Mount", func() {
@@ -1020,6 +1504,174 @@ var _ = Describe("Controller", func() {
 		})
 	*/
 
+	Context(".GetVolumeName", func() {
+		It("should fail since request options does not contain volume name", func() {
+			getVolumeNameRequest := k8sresources.FlexVolumeGetVolumeNameRequest{Opts: map[string]string{"Wwn": "fake"}}
+
+			response := controller.GetVolumeName(getVolumeNameRequest)
+
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(0))
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(response.VolumeName).To(Equal(""))
+		})
+		It("should fail when GetVolume fails", func() {
+			errstr := "volume not found"
+			fakeClient.GetVolumeReturns(resources.Volume{}, fmt.Errorf(errstr))
+			getVolumeNameRequest := k8sresources.FlexVolumeGetVolumeNameRequest{Opts: map[string]string{"volumeName": "pv1"}}
+
+			response := controller.GetVolumeName(getVolumeNameRequest)
+
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
+			Expect(response.Message).To(MatchRegexp(errstr))
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(response.VolumeName).To(Equal(""))
+		})
+		It("should return the volume name when the volume exists", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE}, nil)
+			getVolumeNameRequest := k8sresources.FlexVolumeGetVolumeNameRequest{Opts: map[string]string{"volumeName": "pv1", "Wwn": "fake"}}
+
+			response := controller.GetVolumeName(getVolumeNameRequest)
+
+			Expect(fakeClient.GetVolumeArgsForCall(0).Name).To(Equal("pv1"))
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+			Expect(response.VolumeName).To(Equal("pv1"))
+		})
+	})
+	Context("Ubiquity is not reachable after the volume was mounted", func() {
+		BeforeEach(func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE, Mountpoint: "fake"}, nil)
+			dat[resources.ScbeKeyVolAttachToHost] = "host1"
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			fakeMounter.MountReturns("/ubiquity/fake", nil)
+			fakeMounterFactory.GetMounterPerBackendReturns(fakeMounter, nil)
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+			fakeExec.IsNotExistReturns(true)
+			mountRequest := k8sresources.FlexVolumeMountRequest{MountPath: mountPoint, MountDevice: "pv1", Opts: map[string]string{"Wwn": "fake"}, Version: k8sresources.KubernetesVersion_1_6OrLater}
+			Expect(controller.Mount(mountRequest).Status).To(Equal(ctl.FlexSuccessStr))
+
+			fakeClient.GetVolumeReturns(resources.Volume{}, fmt.Errorf("connection refused"))
+			fakeClient.GetVolumeConfigReturns(nil, fmt.Errorf("connection refused"))
+		})
+		It("should unmount by the volume metadata saved on the node and keep the detach pending", func() {
+			fakeExec.LstatReturns(nil, nil)
+			fakeExec.IsSlinkReturns(true)
+			fakeExec.EvalSymlinksReturns("/ubiquity/fake", nil)
+			fakeExec.GetGlobFilesReturns([]string{}, nil)
+			unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}
+
+			response := controller.Unmount(unmountRequest)
+
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+			Expect(response.Message).To(Equal(ctl.VolumeMetadataFallbackWarningMsg))
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+			Expect(fakeClient.DetachCallCount()).To(Equal(0))
+		})
+		It("should detach the pending volume once ubiquity is reachable again", func() {
+			fakeExec.LstatReturns(nil, nil)
+			fakeExec.IsSlinkReturns(true)
+			fakeExec.EvalSymlinksReturns("/ubiquity/fake", nil)
+			fakeExec.GetGlobFilesReturns([]string{}, nil)
+			Expect(controller.Unmount(k8sresources.FlexVolumeUnmountRequest{MountPath: mountPoint}).Status).To(Equal(ctl.FlexSuccessStr))
+
+			fakeClient.GetVolumeReturns(resources.Volume{}, &resources.VolumeNotFoundError{VolName: "pv2"})
+			fakeClient.GetVolumeReturnsOnCall(2, resources.Volume{Name: "pv2", Backend: resources.SCBE}, nil)
+			fakeClient.GetVolumeConfigReturns(dat, nil)
+			unmountRequest := k8sresources.FlexVolumeUnmountRequest{MountPath: "/tmp/kubelet/pods/1f94f1d9-8f36-11e8-b227-005056a4d4cb/volumes/ibm~ubiquity-k8s-flex/pv2"}
+			fakeExec.LstatReturns(nil, fmt.Errorf("not exist"))
+
+			controller.Unmount(unmountRequest)
+
+			Expect(fakeClient.DetachCallCount()).To(Equal(2)) // the pending detach of pv1 and the legacy detach of pv2
+			Expect(fakeClient.DetachArgsForCall(0).Name).To(Equal("pv1"))
+			Expect(fakeClient.DetachArgsForCall(1).Name).To(Equal("pv2"))
+		})
+		It("should answer IsAttached by the volume metadata saved on the node", func() {
+			isAttachedRequest := k8sresources.FlexVolumeIsAttachedRequest{Host: "host1", Opts: map[string]string{"volumeName": "pv1"}}
+
+			response := controller.IsAttached(isAttachedRequest)
+
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+			Expect(response.Attached).To(BeTrue())
+			Expect(response.Message).To(Equal(ctl.VolumeMetadataFallbackWarningMsg))
+		})
+		It("should fail IsAttached if there is no volume metadata saved on the node", func() {
+			isAttachedRequest := k8sresources.FlexVolumeIsAttachedRequest{Host: "host1", Opts: map[string]string{"volumeName": "pv2"}}
+
+			response := controller.IsAttached(isAttachedRequest)
+
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(response.Message).To(MatchRegexp("connection refused"))
+		})
+	})
+	Context(".WaitForAttach", func() {
+		var (
+			opts map[string]string
+		)
+		BeforeEach(func() {
+			opts = map[string]string{"volumeName": "pv1", "Wwn": "6001738CFC9035E8000000000091E219"}
+		})
+		It("should fail since request options does not contain volume name", func() {
+			waitForAttachRequest := k8sresources.FlexVolumeWaitForAttachRequest{Name: "", Opts: map[string]string{}}
+			response := controller.WaitForAttach(waitForAttachRequest)
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(fakeClient.GetVolumeCallCount()).To(Equal(0))
+		})
+		It("should fail when GetVolume fails", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{}, fmt.Errorf("GetVolume error"))
+			waitForAttachRequest := k8sresources.FlexVolumeWaitForAttachRequest{Name: "", Opts: opts}
+			response := controller.WaitForAttach(waitForAttachRequest)
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(response.Message).To(MatchRegexp("GetVolume error"))
+			Expect(fakeExec.StatCallCount()).To(Equal(0))
+		})
+		It("should return Not supported for SpectrumScale backend", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SpectrumScale}, nil)
+			waitForAttachRequest := k8sresources.FlexVolumeWaitForAttachRequest{Name: "", Opts: opts}
+			response := controller.WaitForAttach(waitForAttachRequest)
+			Expect(response.Status).To(Equal(ctl.FlexNotSupportedStr))
+			Expect(fakeExec.StatCallCount()).To(Equal(0))
+		})
+		It("should fail for unknown backend", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "fake"}, nil)
+			waitForAttachRequest := k8sresources.FlexVolumeWaitForAttachRequest{Name: "", Opts: opts}
+			response := controller.WaitForAttach(waitForAttachRequest)
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(response.Message).To(MatchRegexp(ctl.PvBackendNotSupportedErrorStr))
+		})
+		It("should return the real device path when the multipath device exists", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE}, nil)
+			fakeExec.StatReturns(nil, nil)
+			fakeExec.EvalSymlinksReturns("/dev/dm-3", nil)
+			waitForAttachRequest := k8sresources.FlexVolumeWaitForAttachRequest{Name: "", Opts: opts}
+			response := controller.WaitForAttach(waitForAttachRequest)
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+			Expect(response.Device).To(Equal("/dev/dm-3"))
+			Expect(fakeExec.StatArgsForCall(0)).To(Equal("/dev/disk/by-id/dm-uuid-mpath-36001738cfc9035e8000000000091e219"))
+			Expect(fakeClient.GetVolumeConfigCallCount()).To(Equal(0))
+		})
+		It("should take the wwn from the volume config if it is missing in the request options", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"Wwn": "ABCD"}, nil)
+			fakeExec.StatReturns(nil, nil)
+			fakeExec.EvalSymlinksReturns("/dev/dm-4", nil)
+			waitForAttachRequest := k8sresources.FlexVolumeWaitForAttachRequest{Name: "", Opts: map[string]string{"volumeName": "pv1"}}
+			response := controller.WaitForAttach(waitForAttachRequest)
+			Expect(response.Status).To(Equal(ctl.FlexSuccessStr))
+			Expect(response.Device).To(Equal("/dev/dm-4"))
+			Expect(fakeExec.StatArgsForCall(0)).To(Equal("/dev/disk/by-id/dm-uuid-mpath-3abcd"))
+		})
+		It("should fail if stat of the multipath device fails with error other than not exist", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: resources.SCBE}, nil)
+			fakeExec.StatReturns(nil, fmt.Errorf("stat error"))
+			fakeExec.IsNotExistReturns(false)
+			waitForAttachRequest := k8sresources.FlexVolumeWaitForAttachRequest{Name: "", Opts: opts}
+			response := controller.WaitForAttach(waitForAttachRequest)
+			Expect(response.Status).To(Equal(ctl.FlexFailureStr))
+			Expect(response.Message).To(MatchRegexp("stat error"))
+			Expect(response.Device).To(Equal(""))
+		})
+	})
+
 	Context(".IsAttached", func() {
 		var (
 			host string 
@@ -1060,6 +1712,15 @@ var _ = Describe("Controller", func() {
              Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
         })
 
+        It("IsAttached should fail for unknown backend", func() {
+             fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "fake", Mountpoint: "fake"}, nil)
+             opts := map[string]string{"volumeName": "pv1"}
+             isAttachedRequest := k8sresources.FlexVolumeIsAttachedRequest{"", host, opts, resources.RequestContext{}}
+             isAttachResponse := controller.IsAttached(isAttachedRequest)
+             Expect(isAttachResponse.Status).To(Equal(ctl.FlexFailureStr))
+             Expect(isAttachResponse.Message).To(MatchRegexp(ctl.PvBackendNotSupportedErrorStr))
+        })
+
         It("IsAttached should fail since Request options does not contain volume name", func() {
              fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "spectrum-scale", Mountpoint: "fake"}, nil)
              opts := make(map[string]string)
@@ -1073,7 +1734,7 @@ var _ = Describe("Controller", func() {
 
 	Context(".Detach", func() {
 		BeforeEach(func() {
-
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "vol1", Backend: resources.SCBE}, nil)
 		})
 
         It("Detach should return success when GetVolume Fails with VolumeNotFoundError ", func() {
@@ -1103,6 +1764,15 @@ var _ = Describe("Controller", func() {
              Expect(fakeClient.GetVolumeCallCount()).To(Equal(1))
         })
 
+        It("Detach should fail for unknown backend", func() {
+             fakeClient.GetVolumeReturns(resources.Volume{Name: "pv1", Backend: "fake", Mountpoint: "fake"}, nil)
+             detachRequest := k8sresources.FlexVolumeDetachRequest{"vol1", "fakehost", "version", resources.RequestContext{}}
+             detachResponse := controller.Detach(detachRequest)
+             Expect(detachResponse.Status).To(Equal(ctl.FlexFailureStr))
+             Expect(detachResponse.Message).To(MatchRegexp(ctl.PvBackendNotSupportedErrorStr))
+             Expect(fakeClient.DetachCallCount()).To(Equal(0))
+        })
+
 		It("calling detach works as expected when volume is attached to the host", func() {
 			dat := make(map[string]interface{})
 			host := "host1"
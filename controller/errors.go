@@ -19,6 +19,7 @@ package controller
 import (
 	"fmt"
 	"os"
+	"time"
 )
 
 // TODO need to remove this error, since its moved to ubiquity it self
@@ -79,6 +80,8 @@ func (e *k8sPVDirectoryIsNotDirNorSlinkError) Error() string {
 }
 
 const IdempotentUnmountSkipOnVolumeNotExistWarnigMsg = "Unmount operation requested to work on not exist volume. Assume its idempotent issue - so skip Unmount."
+const IdempotentUnmountDeviceSkipOnVolumeNotExistWarnigMsg = "UnmountDevice operation requested to work on not exist volume. Assume its idempotent issue - so skip UnmountDevice."
+const VolumeMetadataFallbackWarningMsg = "Ubiquity is not reachable, the operation used the volume metadata saved on the node."
 const IdempotentIsAttachedSkipOnVolumeNotExistWarnigMsg = "IsAttached operation requested to work on not exist volume. Assume its idempotent issue - so skip IsAttached."
 const IdempotentDetachSkipOnVolumeNotExistWarnigMsg = "Detach operation requested to work on not exist volume. Assume its idempotent issue - so skip Detach."
 
@@ -95,6 +98,18 @@ func (e *k8sPVDirectoryIsNotSlinkError) Error() string {
 		e.slink, e.fileInfo)
 }
 
+const K8sPVDirectoryIsMountedToWrongMountpointErrorStr = "k8s PV directory, k8s-mountpoint, is already mounted to a wrong mountpoint."
+
+type k8sPVDirectoryIsMountedToWrongMountpointError struct {
+	k8sPVDirectoryPath string
+	expectedMountpoint string
+}
+
+func (e *k8sPVDirectoryIsMountedToWrongMountpointError) Error() string {
+	return fmt.Sprintf(K8sPVDirectoryIsMountedToWrongMountpointErrorStr+" k8s-mountpoint=[%s], expected mountpoint=[%s]",
+		e.k8sPVDirectoryPath, e.expectedMountpoint)
+}
+
 const PvBackendNotSupportedErrorStr = "Backend type not supported."
 
 type PvBackendNotSupportedError struct {
@@ -117,15 +132,6 @@ func (e *BackendNotImplementedGetRealMountpointError) Error() string {
 
 const PVIsAlreadyUsedByAnotherPodMessage = "PV is already in use by another pod and has an existing slink to mountpoint."
 
-type PVIsAlreadyUsedByAnotherPod struct {
-	mountpoint string
-	slink      []string
-}
-
-func (e *PVIsAlreadyUsedByAnotherPod) Error() string {
-	return fmt.Sprintf(PVIsAlreadyUsedByAnotherPodMessage + " mountpoint=[%s], slinks=[%s]", e.mountpoint, e.slink)
-}
-
 var WrongK8sDirectoryPathErrorMessage = fmt.Sprintf("Expected to find [%s] directory in k8s mount path.",K8sPodsDirecotryName)
 
 type WrongK8sDirectoryPathError struct {
@@ -146,3 +152,40 @@ func (e *SpectrumScaleMissingMntPtVolumeError) Error() string {
         return fmt.Sprintf(SpectrumScaleMissingMntPtVolumeErrorStr+" volume=[%s]", e.VolumeName)
 }
 
+
+const WaitForAttachTimeoutErrorStr = "Timeout waiting for the volume device to be attached to the node."
+
+type WaitForAttachTimeoutError struct {
+	VolumeName string
+	Wwn        string
+	Timeout    time.Duration
+}
+
+func (e *WaitForAttachTimeoutError) Error() string {
+	return fmt.Sprintf(WaitForAttachTimeoutErrorStr+" volume=[%s], wwn=[%s], timeout=[%s]", e.VolumeName, e.Wwn, e.Timeout)
+}
+
+const FlockTimeoutErrorStr = "Timeout waiting for a flock that is held by another flex process."
+
+type FlockTimeoutError struct {
+	Flock    string
+	OwnerPid int
+	Timeout  time.Duration
+}
+
+func (e *FlockTimeoutError) Error() string {
+	return fmt.Sprintf(FlockTimeoutErrorStr+" flock=[%s], owner pid=[%d], timeout=[%s]", e.Flock, e.OwnerPid, e.Timeout)
+}
+
+const MountRollbackSucceededMsg = "The mount was rolled back. "
+const MountRollbackFailedMsg = "The mount rollback failed [%s]. "
+
+const InvalidFsGroupErrorStr = "fsGroup must be a numeric group id"
+
+type InvalidFsGroupError struct {
+	FsGroup string
+}
+
+func (e *InvalidFsGroupError) Error() string {
+	return fmt.Sprintf(InvalidFsGroupErrorStr+" fsGroup=[%s]", e.FsGroup)
+}
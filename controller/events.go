@@ -0,0 +1,127 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"os"
+	"strings"
+
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
+	"github.com/IBM/ubiquity/utils/logs"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	ReasonMountFailed   = "UbiquityMountFailed"
+	ReasonUnmountFailed = "UbiquityUnmountFailed"
+	ReasonAttachFailed  = "UbiquityAttachFailed"
+
+	eventSourceComponent = k8sresources.UbiquityK8sFlexVolumeDriverName
+
+	podNodeNameField = "spec.nodeName"
+)
+
+/*
+	The flex is a short lived process, so the events are created directly instead of by an async event broadcaster that may not flush them before the process exits.
+	Events are best effort, failing to record them is only logged and never fails the flex call.
+*/
+
+// recordPodEvent records a warning event on the pod, it does nothing if the flex has no kubernetes client or the pod is unknown.
+func (c *Controller) recordPodEvent(namespace string, name string, uid string, reason string, message string) {
+	if c.kubeClient == nil || namespace == "" || name == "" {
+		return
+	}
+	ref := v1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: namespace, Name: name, UID: types.UID(uid)}
+	c.createEvent(ref, reason, message)
+}
+
+// recordPodEventByMountPath records a warning event on the pod of the k8s mountpoint (/var/lib/kubelet/pods/<pod-uid>/volumes/ibm~ubiquity-k8s-flex/<pv>).
+// The unmount call gets only the k8s mountpoint, so the pod is looked up by its UID among the pods of this node.
+func (c *Controller) recordPodEventByMountPath(k8sPVDirectoryPath string, reason string, message string) {
+	if c.kubeClient == nil {
+		return
+	}
+	podUID, err := getPodUIDFromMountPath(k8sPVDirectoryPath)
+	if err != nil {
+		c.logger.Debug("The mountpoint is not of a pod, skip the event", logs.Args{{"mountpoint", k8sPVDirectoryPath}, {"reason", reason}})
+		return
+	}
+	// kubelet registers the node by its hostname, so the pods of this node are the pods with the hostname as their node.
+	nodeName, err := os.Hostname()
+	if err != nil {
+		c.logger.Warning("Failed to get the hostname to record an event", logs.Args{{"reason", reason}, {"error", err}})
+		return
+	}
+	listOptions := metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector(podNodeNameField, nodeName).String()}
+	pods, err := c.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(listOptions)
+	if err != nil {
+		c.logger.Warning("Failed to list the pods to record an event", logs.Args{{"reason", reason}, {"error", err}})
+		return
+	}
+	for _, pod := range pods.Items {
+		if string(pod.UID) == podUID {
+			c.recordPodEvent(pod.Namespace, pod.Name, podUID, reason, message)
+			return
+		}
+	}
+	c.logger.Debug("The pod of the mountpoint was not found, skip the event", logs.Args{{"mountpoint", k8sPVDirectoryPath}, {"reason", reason}})
+}
+
+func getPodUIDFromMountPath(k8sPVDirectoryPath string) (string, error) {
+	k8sPodsBaseDir, err := getK8sPodsBaseDir(k8sPVDirectoryPath)
+	if err != nil {
+		return "", err
+	}
+	podDirectory := strings.TrimPrefix(k8sPVDirectoryPath, k8sPodsBaseDir+"/")
+	return strings.SplitN(podDirectory, "/", 2)[0], nil
+}
+
+// recordPVEvent records a warning event on the PV, it does nothing if the flex has no kubernetes client.
+func (c *Controller) recordPVEvent(pvName string, reason string, message string) {
+	if c.kubeClient == nil || pvName == "" {
+		return
+	}
+	ref := v1.ObjectReference{Kind: "PersistentVolume", APIVersion: "v1", Name: pvName}
+	c.createEvent(ref, reason, message)
+}
+
+func (c *Controller) createEvent(ref v1.ObjectReference, reason string, message string) {
+	namespace := ref.Namespace
+	if namespace == "" {
+		// Events of cluster scoped objects are kept in the default namespace.
+		namespace = metav1.NamespaceDefault
+	}
+	hostname, _ := os.Hostname()
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{GenerateName: ref.Name + ".", Namespace: namespace},
+		InvolvedObject: ref,
+		Reason:         reason,
+		Message:        message,
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: eventSourceComponent, Host: hostname},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := c.kubeClient.CoreV1().Events(namespace).Create(event); err != nil {
+		c.logger.Warning("Failed to record an event", logs.Args{{"object", ref.Name}, {"reason", reason}, {"error", err}})
+	}
+}
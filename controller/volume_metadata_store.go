@@ -0,0 +1,119 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/IBM/ubiquity/resources"
+)
+
+const (
+	// The store must survive flex calls, so it is kept on the node and not inside the flex process.
+	defaultVolumeMetadataDir = "/var/lib/ubiquity-k8s-flex/volumes"
+	volumeMetadataFileSuffix = ".json"
+)
+
+// volumeMetadata is the volume info the flex learned from ubiquity while mounting the volume on the node.
+// It allows to tear down the volume when the ubiquity server is not reachable.
+type volumeMetadata struct {
+	Volume       resources.Volume       `json:"volume"`
+	VolumeConfig map[string]interface{} `json:"volumeConfig"`
+
+	// DetachPending is set when the volume was unmounted by the metadata only, so its legacy detach is still needed.
+	DetachPending bool `json:"detachPending"`
+}
+
+// volumeMetadataStore keeps one json file per volume in a node local directory.
+type volumeMetadataStore struct {
+	dir string
+}
+
+func newVolumeMetadataStore(dir string) *volumeMetadataStore {
+	return &volumeMetadataStore{dir: dir}
+}
+
+func (s *volumeMetadataStore) path(volumeName string) string {
+	return filepath.Join(s.dir, volumeName+volumeMetadataFileSuffix)
+}
+
+// Save writes the volume metadata, the write is atomic so a crash never leaves a partial file.
+func (s *volumeMetadataStore) Save(metadata volumeMetadata) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(s.dir, "."+metadata.Volume.Name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), s.path(metadata.Volume.Name))
+}
+
+// Load returns nil without error if there is no metadata for the volume.
+func (s *volumeMetadataStore) Load(volumeName string) (*volumeMetadata, error) {
+	data, err := ioutil.ReadFile(s.path(volumeName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	metadata := &volumeMetadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// Delete is idempotent, deleting metadata that does not exist is not an error.
+func (s *volumeMetadataStore) Delete(volumeName string) error {
+	err := os.Remove(s.path(volumeName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns the names of all the volumes that have metadata in the store.
+func (s *volumeMetadataStore) List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+volumeMetadataFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	volumeNames := []string{}
+	for _, file := range files {
+		volumeNames = append(volumeNames, strings.TrimSuffix(filepath.Base(file), volumeMetadataFileSuffix))
+	}
+	return volumeNames, nil
+}
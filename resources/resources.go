@@ -6,6 +6,27 @@ const KubernetesVersion_1_5 = "1.5"
 const KubernetesVersion_1_6OrLater = "atLeast1.6"
 const ProvisionerName = "ubiquity/flex"
 
+// kubelet passes the access mode of the volume to the flex mount call in this option, "ro" for read-only mounts.
+const OptionNameForReadWrite = "kubernetes.io/readwrite"
+const OptionValueReadOnly = "ro"
+
+// kubelet passes the fsGroup of the pod security context to the flex mount call in this option.
+const OptionNameForFsGroup = "kubernetes.io/fsGroup"
+
+// kubelet passes the fsType of the PV to the flex mount call in this option.
+const OptionNameForFsType = "kubernetes.io/fsType"
+
+// kubelet passes the pod of the volume to the flex mount call in these options.
+const OptionNameForPodName = "kubernetes.io/pod.name"
+const OptionNameForPodNamespace = "kubernetes.io/pod.namespace"
+const OptionNameForPodUID = "kubernetes.io/pod.uid"
+
+// The provisioner keeps the StorageClass mountOptions in this PV option, as a comma separated list.
+const OptionNameForMountOptions = "mountOptions"
+
+// The volume config that is passed to the mounter carries the PV fsType in this key.
+const VolumeConfigFsTypeKey = "fstype"
+
 // This ubiquity flexvolume name must be part of the flexvol CLI directory and CLI name in the minions.
 // Here is template of the path:
 // /usr/libexec/kubernetes/kubelet-plugins/volume/exec/${UbiquityK8sFlexVolumeDriverVendor}~${UbiquityK8sFlexVolumeDriverName}/${UbiquityK8sFlexVolumeDriverName}
@@ -20,6 +41,15 @@ const FlexDir = "/usr/libexec/kubernetes/kubelet-plugins/volume/exec/" + Ubiquit
 const FlexLogFilePath = FlexDir + "/" + UbiquityFlexLogFileName
 const FlexConfPath = FlexDir + "/" + UbiquityK8sFlexVolumeDriverName + ".conf"
 
+// UbiquityK8sFlexConfig holds the flex settings that are specific to kubernetes.
+// They are read from the same flex config file as the ubiquity plugin config.
+type UbiquityK8sFlexConfig struct {
+	// DisableFsGroup skips the group ownership and permissions of the fsGroup on mount.
+	DisableFsGroup bool `toml:"disableFsGroup"`
+	// KubeConfig is the kubeconfig file on the node that the flex uses to record its failures as events, no events are recorded if its empty.
+	KubeConfig string `toml:"kubeConfig"`
+}
+
 type FlexVolumeResponse struct {
 	Status     string `json:"status"`
 	Message    string `json:"message"`
@@ -81,5 +111,6 @@ type FlexVolumeUnmountDeviceRequest struct {
 }
 
 type FlexVolumeGetVolumeNameRequest struct {
-	Opts map[string]string `json:"opts"`
+	Opts    map[string]string `json:"opts"`
+	Context resources.RequestContext
 }
@@ -1,3 +0,0 @@
-#!/bin/sh
-
-echo "health cheack passed!"
\ No newline at end of file
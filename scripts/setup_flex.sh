@@ -51,6 +51,8 @@ function generate_flex_conf_from_envs_and_install_it()
     [ -z "$UBIQUITY_PLUGIN_SSL_MODE" ] && UBIQUITY_PLUGIN_SSL_MODE="verify-full" || :
     [ -z "$UBIQUITY_PORT" ] && UBIQUITY_PORT=9999 || :
     [ -z "$UBIQUITY_BACKEND" ] && UBIQUITY_BACKEND=scbe || :
+    [ -z "$FLEX_DISABLE_FSGROUP" ] && FLEX_DISABLE_FSGROUP=false || :
+    [ -z "$FLEX_KUBECONFIG" ] && FLEX_KUBECONFIG="" || :
 
     cat > $FLEX_TMP << EOF
 # This file was generated automatically by the $DRIVER Pod.
@@ -59,6 +61,8 @@ logPath = "$FLEX_LOG_DIR"
 logRotateMaxSize = $FLEX_LOG_ROTATE_MAXSIZE
 backends = ["$UBIQUITY_BACKEND"]
 logLevel = "$LOG_LEVEL"
+disableFsGroup = $FLEX_DISABLE_FSGROUP
+kubeConfig = "$FLEX_KUBECONFIG"
 
 [UbiquityServer]
 address = "0.0.0.0"
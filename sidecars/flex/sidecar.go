@@ -19,8 +19,11 @@ package flex
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/IBM/ubiquity-k8s/utils"
+	"github.com/IBM/ubiquity-k8s/utils/health"
 	watcher "github.com/IBM/ubiquity-k8s/utils/watcher"
 
 	"k8s.io/api/core/v1"
@@ -98,6 +101,20 @@ func (ss *ServiceSyncer) processService(obj interface{}) {
 	}
 }
 
+// CheckUbiquityConnectivity checks that the ubiquity service exists and accepts connections on its ClusterIP,
+// which is the address the flex uses.
+func (ss *ServiceSyncer) CheckUbiquityConnectivity() error {
+	svc, err := ss.kubeClient.CoreV1().Services(ss.namespace).Get(ss.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if svc.Spec.ClusterIP == "" || len(svc.Spec.Ports) == 0 {
+		return fmt.Errorf("service %s has no ClusterIP or port", ss.name)
+	}
+	address := net.JoinHostPort(svc.Spec.ClusterIP, strconv.Itoa(int(svc.Spec.Ports[0].Port)))
+	return health.DialCheck(address, utils.HealthCheckTimeout)()
+}
+
 func (ss *ServiceSyncer) processServiceUpdate(old, cur interface{}) {
 	if old == nil {
 		ss.processService(cur)
@@ -2,6 +2,7 @@ package flex
 
 import (
 	"context"
+	"net"
 	"os"
 	"time"
 
@@ -165,3 +166,48 @@ var _ = PDescribe("ServiceSyncer", func() {
 		})
 	})
 })
+
+var _ = Describe("ServiceSyncer.CheckUbiquityConnectivity", func() {
+
+	var ss *ServiceSyncer
+	var kubeClient *fakekubeclientset.Clientset
+	var listener net.Listener
+
+	BeforeEach(func() {
+		var err error
+		os.Setenv("NAMESPACE", "ubiquity")
+		kubeClient = fakekubeclientset.NewSimpleClientset()
+		ss, err = NewServiceSyncer(kubeClient, context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Setenv("NAMESPACE", "")
+		listener.Close()
+	})
+
+	createService := func(port int32) {
+		kubeClient.CoreV1().Services("ubiquity").Create(&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ubiquity", Name: utils.UbiquityServiceName},
+			Spec:       v1.ServiceSpec{ClusterIP: "127.0.0.1", Ports: []v1.ServicePort{{Port: port}}},
+		})
+	}
+
+	It("should pass if the ubiquity service accepts connections", func() {
+		createService(int32(listener.Addr().(*net.TCPAddr).Port))
+		Ω(ss.CheckUbiquityConnectivity()).Should(Succeed())
+	})
+
+	It("should fail if the ubiquity service does not exist", func() {
+		Ω(ss.CheckUbiquityConnectivity()).ShouldNot(Succeed())
+	})
+
+	It("should fail if the ubiquity service does not accept connections", func() {
+		port := int32(listener.Addr().(*net.TCPAddr).Port)
+		listener.Close()
+		createService(port)
+		Ω(ss.CheckUbiquityConnectivity()).ShouldNot(Succeed())
+	})
+})
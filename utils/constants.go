@@ -1,7 +1,29 @@
 package utils
 
+import "time"
+
 const (
 	DefaultlogLevel     = "info"
 	UbiquityServiceName = "ubiquity"
 	ENVNamespace        = "NAMESPACE"
+
+	// The provisioner replicas elect their leader by this ConfigMap in their namespace.
+	DefaultLeaderElectionLockName      = "ubiquity-k8s-provisioner-leader"
+	DefaultLeaderElectionLeaseDuration = 15 * time.Second
+	DefaultLeaderElectionRenewDeadline = 10 * time.Second
+	DefaultLeaderElectionRetryPeriod   = 2 * time.Second
+
+	// The provisioner records the volumes that it created in this ConfigMap in its namespace.
+	VolumeOwnershipConfigMapName = "ubiquity-k8s-provisioner-volumes"
+
+	// The provisioner serves its prometheus metrics on this port, unless METRICS_PORT is set.
+	DefaultMetricsPort = "9100"
+
+	// The provisioner compares the ubiquity volumes with the PVs periodically, and deletes orphan volumes only if it is enabled.
+	DefaultReconcilePeriod   = 10 * time.Minute
+	DefaultOrphanGracePeriod = time.Hour
+
+	// The provisioner and the flex sidecar serve their liveness and readiness endpoints on this port, unless HEALTH_PORT is set.
+	DefaultHealthPort  = "9808"
+	HealthCheckTimeout = 5 * time.Second
 )
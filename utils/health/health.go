@@ -0,0 +1,103 @@
+package health
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Check returns an error if the dependency it checks is not available.
+type Check func() error
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the JSON body of the liveness and readiness endpoints.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker serves a liveness endpoint, which passes as long as the process serves it,
+// and a readiness endpoint, which passes only if all its checks pass.
+type Checker struct {
+	lock   sync.RWMutex
+	checks map[string]Check
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// AddReadinessCheck adds a check to the readiness endpoint, a check with the same name is replaced.
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checks[name] = check
+}
+
+// Ready runs all the readiness checks and reports each of them.
+func (c *Checker) Ready() Report {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult)}
+	for name, check := range c.checks {
+		if err := check(); err != nil {
+			report.Status = StatusFailed
+			report.Checks[name] = CheckResult{Status: StatusFailed, Error: err.Error()}
+		} else {
+			report.Checks[name] = CheckResult{Status: StatusOK}
+		}
+	}
+	return report
+}
+
+// RegisterHandlers adds the liveness and readiness endpoints to the mux.
+func (c *Checker) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Report{Status: StatusOK})
+	})
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Ready())
+	})
+}
+
+// ListenAndServe serves the liveness and readiness endpoints on the address until it fails.
+func (c *Checker) ListenAndServe(address string) error {
+	mux := http.NewServeMux()
+	c.RegisterHandlers(mux)
+	return http.ListenAndServe(address, mux)
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// DialCheck returns a check that passes if a TCP connection to the address can be opened within the timeout.
+func DialCheck(address string, timeout time.Duration) Check {
+	return func() error {
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
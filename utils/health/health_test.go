@@ -0,0 +1,86 @@
+package health_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/IBM/ubiquity-k8s/utils/health"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+	var (
+		checker *Checker
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		checker = NewChecker()
+		mux := http.NewServeMux()
+		checker.RegisterHandlers(mux)
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(path string) (int, Report) {
+		response, err := http.Get(server.URL + path)
+		Expect(err).To(Not(HaveOccurred()))
+		defer response.Body.Close()
+		var report Report
+		Expect(json.NewDecoder(response.Body).Decode(&report)).To(Succeed())
+		return response.StatusCode, report
+	}
+
+	Context("liveness", func() {
+		It("passes even if a readiness check fails", func() {
+			checker.AddReadinessCheck("ubiquity", func() error { return fmt.Errorf("connection refused") })
+			code, report := get(LivenessPath)
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(report.Status).To(Equal(StatusOK))
+		})
+	})
+
+	Context("readiness", func() {
+		It("passes if all the checks pass", func() {
+			checker.AddReadinessCheck("ubiquity", func() error { return nil })
+			checker.AddReadinessCheck("kubernetes", func() error { return nil })
+			code, report := get(ReadinessPath)
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(report.Status).To(Equal(StatusOK))
+			Expect(report.Checks).To(HaveLen(2))
+		})
+		It("fails and reports the error of the failed check", func() {
+			checker.AddReadinessCheck("ubiquity", func() error { return fmt.Errorf("connection refused") })
+			checker.AddReadinessCheck("kubernetes", func() error { return nil })
+			code, report := get(ReadinessPath)
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.Status).To(Equal(StatusFailed))
+			Expect(report.Checks["ubiquity"]).To(Equal(CheckResult{Status: StatusFailed, Error: "connection refused"}))
+			Expect(report.Checks["kubernetes"]).To(Equal(CheckResult{Status: StatusOK}))
+		})
+	})
+
+	Context("DialCheck", func() {
+		It("passes if the address accepts connections", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(Not(HaveOccurred()))
+			defer listener.Close()
+			Expect(DialCheck(listener.Addr().String(), time.Second)()).To(Succeed())
+		})
+		It("fails if the address does not accept connections", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(Not(HaveOccurred()))
+			address := listener.Addr().String()
+			listener.Close()
+			Expect(DialCheck(address, time.Second)()).To(HaveOccurred())
+		})
+	})
+})
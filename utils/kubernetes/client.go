@@ -31,11 +31,7 @@ func GetClientset(baseName string) kubernetes.Interface {
 // set to "ubiquity" if we, the ubiquity hook executor, is calling the APIs.
 // Note that we only need the in-cluster way in production env, others are for test perpose only.
 func Config(kubeconfig, kubecontext, baseName string) (*rest.Config, error) {
-	rules := clientcmd.NewDefaultClientConfigLoadingRules()
-	rules.ExplicitPath = kubeconfig
-	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: kubecontext}
-	newConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, configOverrides)
-	clientConfig, err := newConfig.ClientConfig()
+	clientConfig, err := loadingClientConfig(kubeconfig, kubecontext).ClientConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +45,20 @@ func Config(kubeconfig, kubecontext, baseName string) (*rest.Config, error) {
 	return clientConfig, nil
 }
 
+// Namespace returns the namespace of the kubeconfig context (if specified)
+// or the namespace of the pod if running in-cluster.
+func Namespace(kubeconfig, kubecontext string) (string, error) {
+	namespace, _, err := loadingClientConfig(kubeconfig, kubecontext).Namespace()
+	return namespace, err
+}
+
+func loadingClientConfig(kubeconfig, kubecontext string) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: kubecontext}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, configOverrides)
+}
+
 func buildUserAgent(command, os, arch string) string {
 	return fmt.Sprintf(
 		"%s (%s/%s)", command, os, arch)
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	uberrors "github.com/IBM/ubiquity-k8s/utils/errors"
 	"github.com/IBM/ubiquity/resources"
@@ -42,6 +43,101 @@ func LoadConfig() (resources.UbiquityPluginConfig, error) {
 	return config, nil
 }
 
+// LeaderElectionConfig holds the leader election settings of the provisioner replicas.
+type LeaderElectionConfig struct {
+	Enabled       bool
+	Namespace     string
+	LockName      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// LoadLeaderElectionConfig reads the leader election settings from the env, unset settings get the defaults.
+// The namespace is defaultNamespace if the NAMESPACE env is not set.
+func LoadLeaderElectionConfig(defaultNamespace string) (LeaderElectionConfig, error) {
+	config := LeaderElectionConfig{
+		Enabled:       true,
+		Namespace:     defaultNamespace,
+		LockName:      DefaultLeaderElectionLockName,
+		LeaseDuration: DefaultLeaderElectionLeaseDuration,
+		RenewDeadline: DefaultLeaderElectionRenewDeadline,
+		RetryPeriod:   DefaultLeaderElectionRetryPeriod,
+	}
+	if namespace := os.Getenv(ENVNamespace); namespace != "" {
+		config.Namespace = namespace
+	}
+	var err error
+	if enabled := os.Getenv("LEADER_ELECTION"); enabled != "" {
+		if config.Enabled, err = strconv.ParseBool(enabled); err != nil {
+			return config, err
+		}
+	}
+	if !config.Enabled {
+		return config, nil
+	}
+	if config.Namespace == "" {
+		return config, uberrors.ENVNamespaceNotSet
+	}
+	if lockName := os.Getenv("LEADER_ELECTION_LOCK_NAME"); lockName != "" {
+		config.LockName = lockName
+	}
+	durations := []struct {
+		envVar string
+		value  *time.Duration
+	}{
+		{"LEADER_ELECTION_LEASE_DURATION", &config.LeaseDuration},
+		{"LEADER_ELECTION_RENEW_DEADLINE", &config.RenewDeadline},
+		{"LEADER_ELECTION_RETRY_PERIOD", &config.RetryPeriod},
+	}
+	for _, duration := range durations {
+		if value := os.Getenv(duration.envVar); value != "" {
+			if *duration.value, err = time.ParseDuration(value); err != nil {
+				return config, err
+			}
+		}
+	}
+	return config, nil
+}
+
+// ReconcilerConfig holds the settings of the reconciler of orphan volumes, a zero Period disables it.
+type ReconcilerConfig struct {
+	Period        time.Duration
+	DeleteOrphans bool
+	GracePeriod   time.Duration
+}
+
+// LoadReconcilerConfig reads the reconciler settings from the env, unset settings get the defaults.
+func LoadReconcilerConfig() (ReconcilerConfig, error) {
+	config := ReconcilerConfig{Period: DefaultReconcilePeriod, GracePeriod: DefaultOrphanGracePeriod}
+	var err error
+	if period := os.Getenv("RECONCILE_PERIOD"); period != "" {
+		if config.Period, err = time.ParseDuration(period); err != nil {
+			return config, err
+		}
+	}
+	if deleteOrphans := os.Getenv("DELETE_ORPHAN_VOLUMES"); deleteOrphans != "" {
+		if config.DeleteOrphans, err = strconv.ParseBool(deleteOrphans); err != nil {
+			return config, err
+		}
+	}
+	if gracePeriod := os.Getenv("ORPHAN_GRACE_PERIOD"); gracePeriod != "" {
+		if config.GracePeriod, err = time.ParseDuration(gracePeriod); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// GetHealthAddress returns the address of the liveness and readiness endpoints.
+func GetHealthAddress() string {
+	port := os.Getenv("HEALTH_PORT")
+	if port == "" {
+		port = DefaultHealthPort
+	}
+	return ":" + port
+}
+
 func GetCurrentNamespace() (string, error) {
 	ns := os.Getenv(ENVNamespace)
 	if ns == "" {
@@ -6,6 +6,7 @@ import (
 	. "github.com/onsi/gomega"
 	"os"
 	"strconv"
+	"time"
 )
 
 var _ = Describe("Utils", func() {
@@ -108,4 +109,91 @@ var _ = Describe("Utils", func() {
 		})
 
 	})
+
+	Context(".LoadReconcilerConfig", func() {
+		envVars := []string{"RECONCILE_PERIOD", "DELETE_ORPHAN_VOLUMES", "ORPHAN_GRACE_PERIOD"}
+		AfterEach(func() {
+			for _, envVar := range envVars {
+				os.Unsetenv(envVar)
+			}
+		})
+		It("returns the defaults if nothing is set", func() {
+			config, err := LoadReconcilerConfig()
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(config).To(Equal(ReconcilerConfig{Period: DefaultReconcilePeriod, GracePeriod: DefaultOrphanGracePeriod}))
+		})
+		It("returns the settings from the env", func() {
+			os.Setenv("RECONCILE_PERIOD", "0")
+			os.Setenv("DELETE_ORPHAN_VOLUMES", "true")
+			os.Setenv("ORPHAN_GRACE_PERIOD", "24h")
+			config, err := LoadReconcilerConfig()
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(config).To(Equal(ReconcilerConfig{Period: 0, DeleteOrphans: true, GracePeriod: 24 * time.Hour}))
+		})
+		It("fails if the grace period is not a duration", func() {
+			os.Setenv("ORPHAN_GRACE_PERIOD", "1")
+			_, err := LoadReconcilerConfig()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context(".LoadLeaderElectionConfig", func() {
+		envVars := []string{"NAMESPACE", "LEADER_ELECTION", "LEADER_ELECTION_LOCK_NAME", "LEADER_ELECTION_LEASE_DURATION", "LEADER_ELECTION_RENEW_DEADLINE", "LEADER_ELECTION_RETRY_PERIOD"}
+		BeforeEach(func() {
+			for _, envVar := range envVars {
+				os.Unsetenv(envVar)
+			}
+			os.Setenv("NAMESPACE", "ubiquity")
+		})
+		AfterEach(func() {
+			for _, envVar := range envVars {
+				os.Unsetenv(envVar)
+			}
+		})
+		It("returns the defaults if only the namespace is set", func() {
+			config, err := LoadLeaderElectionConfig("")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(config.Enabled).To(BeTrue())
+			Expect(config.Namespace).To(Equal("ubiquity"))
+			Expect(config.LockName).To(Equal(DefaultLeaderElectionLockName))
+			Expect(config.LeaseDuration).To(Equal(DefaultLeaderElectionLeaseDuration))
+			Expect(config.RenewDeadline).To(Equal(DefaultLeaderElectionRenewDeadline))
+			Expect(config.RetryPeriod).To(Equal(DefaultLeaderElectionRetryPeriod))
+		})
+		It("returns the timings from the env", func() {
+			os.Setenv("LEADER_ELECTION_LOCK_NAME", "lock")
+			os.Setenv("LEADER_ELECTION_LEASE_DURATION", "30s")
+			os.Setenv("LEADER_ELECTION_RENEW_DEADLINE", "20s")
+			os.Setenv("LEADER_ELECTION_RETRY_PERIOD", "5s")
+			config, err := LoadLeaderElectionConfig("")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(config.LockName).To(Equal("lock"))
+			Expect(config.LeaseDuration).To(Equal(30 * time.Second))
+			Expect(config.RenewDeadline).To(Equal(20 * time.Second))
+			Expect(config.RetryPeriod).To(Equal(5 * time.Second))
+		})
+		It("fails if a timing is not a duration", func() {
+			os.Setenv("LEADER_ELECTION_LEASE_DURATION", "15")
+			_, err := LoadLeaderElectionConfig("")
+			Expect(err).To(HaveOccurred())
+		})
+		It("fails if the namespace is not set", func() {
+			os.Unsetenv("NAMESPACE")
+			_, err := LoadLeaderElectionConfig("")
+			Expect(err).To(HaveOccurred())
+		})
+		It("returns the default namespace if the namespace is not set", func() {
+			os.Unsetenv("NAMESPACE")
+			config, err := LoadLeaderElectionConfig("dev")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(config.Namespace).To(Equal("dev"))
+		})
+		It("does not need the namespace if the leader election is disabled", func() {
+			os.Unsetenv("NAMESPACE")
+			os.Setenv("LEADER_ELECTION", "false")
+			config, err := LoadLeaderElectionConfig("")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(config.Enabled).To(BeFalse())
+		})
+	})
 })
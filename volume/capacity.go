@@ -0,0 +1,87 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/IBM/ubiquity/resources"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	mib = int64(1024 * 1024)
+	gib = 1024 * mib
+)
+
+// backendCapacity describes how a backend allocates capacity: the granularity of its volumes,
+// and the volume config key that reports the allocated size (in the given unit if the value has no unit suffix).
+type backendCapacity struct {
+	granularity int64
+	configKey   string
+	configUnit  int64
+}
+
+var backendCapacities = map[string]backendCapacity{
+	// SCBE volumes are allocated in whole GB, the size option is in GB.
+	resources.SCBE: {granularity: gib, configKey: "size", configUnit: gib},
+	// Spectrum Scale filesets are limited by a quota in MB.
+	resources.SpectrumScale: {granularity: mib, configKey: "quota", configUnit: mib},
+}
+
+// roundUpCapacity rounds the requested bytes up to the granularity of the backend, so the backend never allocates less than requested.
+func roundUpCapacity(requestedBytes int64, backend string) int64 {
+	granularity := mib
+	if capacity, ok := backendCapacities[backend]; ok {
+		granularity = capacity.granularity
+	}
+	return (requestedBytes + granularity - 1) / granularity * granularity
+}
+
+// provisionedCapacity returns the size the backend reports in the volume config.
+// It falls back to the requested bytes rounded up to the backend granularity, if the size is not reported
+// or is smaller than requested (a PV smaller than its PVC request cannot be bound).
+func provisionedCapacity(volumeConfig map[string]string, backend string, requestedBytes int64) k8sresource.Quantity {
+	roundedBytes := roundUpCapacity(requestedBytes, backend)
+	if capacity, ok := backendCapacities[backend]; ok {
+		if reportedBytes, ok := parseCapacity(volumeConfig[capacity.configKey], capacity.configUnit); ok && reportedBytes >= requestedBytes {
+			return *k8sresource.NewQuantity(reportedBytes, k8sresource.BinarySI)
+		}
+	}
+	return *k8sresource.NewQuantity(roundedBytes, k8sresource.BinarySI)
+}
+
+// parseCapacity parses sizes such as 1024, 1024M or 1G, a value without a unit suffix is in defaultUnit.
+func parseCapacity(value string, defaultUnit int64) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	unit := defaultUnit
+	switch {
+	case strings.HasSuffix(value, "M"):
+		unit, value = mib, strings.TrimSuffix(value, "M")
+	case strings.HasSuffix(value, "G"):
+		unit, value = gib, strings.TrimSuffix(value, "G")
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, false
+	}
+	return size * unit, true
+}
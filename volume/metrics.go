@@ -0,0 +1,180 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "ubiquity_k8s"
+	metricsSubsystem = "provisioner"
+
+	metricStatusSuccess = "success"
+	metricStatusFailure = "failure"
+)
+
+var (
+	provisionTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "provision_total",
+			Help:      "Number of volume provisions by backend, StorageClass and status.",
+		},
+		[]string{"backend", "storage_class", "status"},
+	)
+	provisionDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "provision_duration_seconds",
+			Help:      "Duration of the volume provisions by backend, StorageClass and status.",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+		},
+		[]string{"backend", "storage_class", "status"},
+	)
+	deleteTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "delete_total",
+			Help:      "Number of volume deletions by backend, StorageClass and status.",
+		},
+		[]string{"backend", "storage_class", "status"},
+	)
+	deleteDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "delete_duration_seconds",
+			Help:      "Duration of the volume deletions by backend, StorageClass and status.",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+		},
+		[]string{"backend", "storage_class", "status"},
+	)
+	ubiquityCallTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "ubiquity_calls_total",
+			Help:      "Number of calls to the ubiquity server by operation, backend, StorageClass and status.",
+		},
+		[]string{"operation", "backend", "storage_class", "status"},
+	)
+	ubiquityCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "ubiquity_call_duration_seconds",
+			Help:      "Duration of the calls to the ubiquity server by operation, backend, StorageClass and status.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		},
+		[]string{"operation", "backend", "storage_class", "status"},
+	)
+	backendActivated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "backend_activated",
+			Help:      "Whether the backend was activated by the ubiquity server (1) or not (0).",
+		},
+		[]string{"backend"},
+	)
+	orphanVolumes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "orphan_volumes",
+			Help:      "Number of ubiquity volumes that no PV uses, by backend, as of the last reconcile.",
+		},
+		[]string{"backend"},
+	)
+	missingVolumes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "missing_volumes",
+			Help:      "Number of PVs whose volume ubiquity does not know, by StorageClass, as of the last reconcile.",
+		},
+		[]string{"storage_class"},
+	)
+	orphanVolumesDeleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "orphan_volumes_deleted_total",
+			Help:      "Number of orphan ubiquity volumes that the reconciler deleted, by backend.",
+		},
+		[]string{"backend"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(provisionTotal, provisionDuration, deleteTotal, deleteDuration, ubiquityCallTotal, ubiquityCallDuration, backendActivated,
+		orphanVolumes, missingVolumes, orphanVolumesDeleted)
+}
+
+func metricStatus(err error) string {
+	if err != nil {
+		return metricStatusFailure
+	}
+	return metricStatusSuccess
+}
+
+func observeProvision(backend string, storageClass string, start time.Time, err error) {
+	status := metricStatus(err)
+	provisionTotal.WithLabelValues(backend, storageClass, status).Inc()
+	provisionDuration.WithLabelValues(backend, storageClass, status).Observe(time.Since(start).Seconds())
+}
+
+func observeDelete(backend string, storageClass string, start time.Time, err error) {
+	status := metricStatus(err)
+	deleteTotal.WithLabelValues(backend, storageClass, status).Inc()
+	deleteDuration.WithLabelValues(backend, storageClass, status).Observe(time.Since(start).Seconds())
+}
+
+// observeUbiquityCall records a call to the ubiquity server, the StorageClass is empty for calls that are not made for a PV.
+func observeUbiquityCall(operation string, backend string, storageClass string, start time.Time, err error) {
+	status := metricStatus(err)
+	ubiquityCallTotal.WithLabelValues(operation, backend, storageClass, status).Inc()
+	ubiquityCallDuration.WithLabelValues(operation, backend, storageClass, status).Observe(time.Since(start).Seconds())
+}
+
+func setBackendsActivated(backends []string, activated bool) {
+	value := 0.0
+	if activated {
+		value = 1
+	}
+	for _, backend := range backends {
+		backendActivated.WithLabelValues(backend).Set(value)
+	}
+}
+
+// setDriftMetrics replaces the drift of the previous reconcile, so a backend or StorageClass without drift is no longer reported.
+func setDriftMetrics(orphansByBackend map[string]int, missingByStorageClass map[string]int) {
+	orphanVolumes.Reset()
+	for backend, count := range orphansByBackend {
+		orphanVolumes.WithLabelValues(backend).Set(float64(count))
+	}
+	missingVolumes.Reset()
+	for storageClass, count := range missingByStorageClass {
+		missingVolumes.WithLabelValues(storageClass).Set(float64(count))
+	}
+}
@@ -0,0 +1,117 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume_test
+
+import (
+	"fmt"
+
+	"github.com/IBM/ubiquity-k8s/volume"
+	"github.com/IBM/ubiquity/fakes"
+	"github.com/IBM/ubiquity/resources"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		fakeClient  *fakes.FakeStorageClient
+		provisioner controller.Provisioner
+		err         error
+	)
+
+	BeforeEach(func() {
+		fakeClient = new(fakes.FakeStorageClient)
+		provisioner, err = volume.NewFlexProvisioner(testLogger, fakeClient, nil, nil, resources.UbiquityPluginConfig{Backends: []string{resources.SCBE}})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reports the activated backends", func() {
+		Expect(metricValue("ubiquity_k8s_provisioner_backend_activated", map[string]string{"backend": resources.SCBE})).To(Equal(1.0))
+
+		fakeClient.ActivateReturns(fmt.Errorf("activate error"))
+		volume.NewFlexProvisioner(testLogger, fakeClient, nil, nil, resources.UbiquityPluginConfig{Backends: []string{resources.SCBE}})
+
+		Expect(metricValue("ubiquity_k8s_provisioner_backend_activated", map[string]string{"backend": resources.SCBE})).To(Equal(0.0))
+		// Let the background activation succeed.
+		fakeClient.ActivateReturns(nil)
+	})
+	It("counts the provisions and their ubiquity calls by backend and StorageClass", func() {
+		provisionLabels := map[string]string{"backend": resources.SCBE, "storage_class": "gold", "status": "success"}
+		createVolumeLabels := map[string]string{"operation": "CreateVolume", "backend": resources.SCBE, "storage_class": "gold", "status": "success"}
+		provisions := metricValue("ubiquity_k8s_provisioner_provision_total", provisionLabels)
+		createVolumeCalls := metricValue("ubiquity_k8s_provisioner_ubiquity_calls_total", createVolumeLabels)
+		storageClass := "gold"
+		options := controller.VolumeOptions{
+			PVName:     "fakepv",
+			Parameters: map[string]string{"backend": resources.SCBE},
+			PVC: &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{
+				StorageClassName: &storageClass,
+				Resources:        v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}},
+			}},
+		}
+
+		_, err = provisioner.Provision(options)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metricValue("ubiquity_k8s_provisioner_provision_total", provisionLabels)).To(Equal(provisions + 1))
+		Expect(metricValue("ubiquity_k8s_provisioner_ubiquity_calls_total", createVolumeLabels)).To(Equal(createVolumeCalls + 1))
+	})
+	It("counts the failed deletions by backend and StorageClass", func() {
+		deleteLabels := map[string]string{"backend": resources.SCBE, "storage_class": "gold", "status": "failure"}
+		deletions := metricValue("ubiquity_k8s_provisioner_delete_total", deleteLabels)
+		fakeClient.GetVolumeReturns(resources.Volume{Name: "vol1", Backend: resources.SCBE}, nil)
+		fakeClient.RemoveVolumeReturns(fmt.Errorf("error removing volume"))
+		pv := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "vol1"}, Spec: v1.PersistentVolumeSpec{StorageClassName: "gold"}}
+
+		err = provisioner.Delete(pv)
+
+		Expect(err).To(HaveOccurred())
+		Expect(metricValue("ubiquity_k8s_provisioner_delete_total", deleteLabels)).To(Equal(deletions + 1))
+	})
+})
+
+// metricValue returns the value of the counter or gauge with the given labels from the default registry, or 0 if it was not reported yet.
+func metricValue(name string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	Expect(err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.Metric {
+			matches := 0
+			for _, label := range metric.Label {
+				if labels[label.GetName()] == label.GetValue() {
+					matches++
+				}
+			}
+			if matches != len(labels) {
+				continue
+			}
+			if metric.Counter != nil {
+				return metric.Counter.GetValue()
+			}
+			return metric.Gauge.GetValue()
+		}
+	}
+	return 0
+}
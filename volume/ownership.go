@@ -0,0 +1,167 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume
+
+import (
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// VolumeOwnership records the ubiquity volumes that the provisioner created, with the reclaim policy of their PV,
+// in a ConfigMap of the provisioner namespace. The ubiquity DB is shared with the docker plugin and with other clusters,
+// so the provisioner adopts, and the reconciler deletes, only the volumes that it owns.
+type VolumeOwnership struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+}
+
+func NewVolumeOwnership(kubeClient kubernetes.Interface, namespace string, name string) *VolumeOwnership {
+	return &VolumeOwnership{kubeClient: kubeClient, namespace: namespace, name: name}
+}
+
+// Add records the volume as owned, with the reclaim policy of its PV.
+func (o *VolumeOwnership) Add(volumeName string, reclaimPolicy v1.PersistentVolumeReclaimPolicy) error {
+	return o.update(func(data map[string]string) bool {
+		if policy, exists := data[volumeName]; exists && policy == string(reclaimPolicy) {
+			return false
+		}
+		data[volumeName] = string(reclaimPolicy)
+		return true
+	})
+}
+
+// Remove forgets the volume, it does nothing if the volume is not owned.
+func (o *VolumeOwnership) Remove(volumeName string) error {
+	return o.update(func(data map[string]string) bool {
+		if _, exists := data[volumeName]; !exists {
+			return false
+		}
+		delete(data, volumeName)
+		return true
+	})
+}
+
+// Get returns the recorded reclaim policy of the volume, and whether the volume is owned.
+func (o *VolumeOwnership) Get(volumeName string) (v1.PersistentVolumeReclaimPolicy, bool, error) {
+	volumes, err := o.List()
+	if err != nil {
+		return "", false, err
+	}
+	reclaimPolicy, owned := volumes[volumeName]
+	return reclaimPolicy, owned, nil
+}
+
+// List returns the reclaim policies of all the owned volumes by their name.
+func (o *VolumeOwnership) List() (map[string]v1.PersistentVolumeReclaimPolicy, error) {
+	volumes := make(map[string]v1.PersistentVolumeReclaimPolicy)
+	configMap, err := o.kubeClient.CoreV1().ConfigMaps(o.namespace).Get(o.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return volumes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for volumeName, reclaimPolicy := range configMap.Data {
+		volumes[volumeName] = v1.PersistentVolumeReclaimPolicy(reclaimPolicy)
+	}
+	return volumes, nil
+}
+
+// Sync records the volumes of the PVs that the provisioner created, with the current reclaim policy of the PV.
+// So the volumes that were provisioned before their ownership was recorded become owned, and a reclaim policy
+// that an admin changed on the PV is recorded.
+func (o *VolumeOwnership) Sync(pvs []v1.PersistentVolume) error {
+	return o.update(func(data map[string]string) bool {
+		changed := false
+		for i := range pvs {
+			pv := &pvs[i]
+			volumeName := getFlexVolumeName(pv)
+			if pv.Annotations[annCreatedBy] != createdBy || volumeName == "" {
+				continue
+			}
+			if policy, exists := data[volumeName]; !exists || policy != string(pv.Spec.PersistentVolumeReclaimPolicy) {
+				data[volumeName] = string(pv.Spec.PersistentVolumeReclaimPolicy)
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// update applies change to the records and saves them if change returns true. The ConfigMap is created with the first record,
+// and the change is retried if another provision or replica updated the ConfigMap meanwhile.
+func (o *VolumeOwnership) update(change func(data map[string]string) bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMaps := o.kubeClient.CoreV1().ConfigMaps(o.namespace)
+		configMap, err := configMaps.Get(o.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			data := make(map[string]string)
+			if !change(data) {
+				return nil
+			}
+			_, err = configMaps.Create(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: o.namespace, Name: o.name}, Data: data})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(v1.Resource("configmaps"), o.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		if !change(configMap.Data) {
+			return nil
+		}
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+}
+
+// findVolumePV returns the name of the PV that uses the volume, by the PV name or by the volumeName option of the flex driver.
+// The name is empty if no PV uses the volume.
+func findVolumePV(kubeClient kubernetes.Interface, volumeName string) (string, error) {
+	pvs, err := kubeClient.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if pv.Name == volumeName || getFlexVolumeName(pv) == volumeName {
+			return pv.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// getFlexVolumeName returns the name of the ubiquity volume of the PV, from the volumeName option of the flex driver or else the PV name.
+// The name is empty if the PV is not of the flex driver.
+func getFlexVolumeName(pv *v1.PersistentVolume) string {
+	if pv.Spec.FlexVolume == nil || pv.Spec.FlexVolume.Driver != k8sresources.UbiquityK8sFlexVolumeDriverFullName {
+		return ""
+	}
+	if volumeName := pv.Spec.FlexVolume.Options["volumeName"]; volumeName != "" {
+		return volumeName
+	}
+	return pv.Name
+}
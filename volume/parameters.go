@@ -0,0 +1,153 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/ubiquity/resources"
+)
+
+const paramBackend = "backend"
+
+type paramType string
+
+const (
+	paramTypeString paramType = "string"
+	paramTypeInt    paramType = "integer"
+	paramTypeBool   paramType = "boolean"
+)
+
+// paramSpec describes a StorageClass parameter, allowedValues is empty if any value of the type is allowed.
+type paramSpec struct {
+	valueType     paramType
+	required      bool
+	allowedValues []string
+}
+
+// backendParams holds the StorageClass parameters that each known backend accepts, on top of the backend parameter itself.
+// Any other parameter of a known backend is rejected, so a typo does not silently fall back to the ubiquity defaults.
+// The parameters of other backends are passed as is to ubiquity, which validates them.
+var backendParams = map[string]map[string]paramSpec{
+	resources.SCBE: {
+		"profile":   {valueType: paramTypeString},
+		paramFsType: {valueType: paramTypeString, allowedValues: []string{"ext4", "xfs"}},
+	},
+	resources.SpectrumScale: {
+		"filesystem":    {valueType: paramTypeString},
+		"type":          {valueType: paramTypeString, allowedValues: []string{"fileset", "lightweight"}},
+		"fileset":       {valueType: paramTypeString},
+		"fileset-type":  {valueType: paramTypeString, allowedValues: []string{"independent", "dependent"}},
+		"directory":     {valueType: paramTypeString},
+		"quota":         {valueType: paramTypeString},
+		"uid":           {valueType: paramTypeInt},
+		"gid":           {valueType: paramTypeInt},
+		"inode-limit":   {valueType: paramTypeInt},
+		"isPreexisting": {valueType: paramTypeBool},
+	},
+}
+
+type InvalidParametersError struct {
+	Backend string
+	Reason  string
+}
+
+func (e *InvalidParametersError) Error() string {
+	if e.Backend == "" {
+		return fmt.Sprintf("invalid StorageClass parameters: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid StorageClass parameters for backend %s: %s", e.Backend, e.Reason)
+}
+
+// validateParameters checks the StorageClass parameters against the schema of their backend, if the backend has one.
+func validateParameters(parameters map[string]string) error {
+	backend, exists := parameters[paramBackend]
+	if !exists || backend == "" {
+		return &InvalidParametersError{Reason: fmt.Sprintf("parameter %q is required, known values are %v", paramBackend, supportedBackends())}
+	}
+	specs, ok := backendParams[backend]
+	if !ok {
+		return nil
+	}
+
+	keys := make([]string, 0, len(parameters))
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == paramBackend {
+			continue
+		}
+		spec, ok := specs[key]
+		if !ok {
+			return &InvalidParametersError{Backend: backend, Reason: fmt.Sprintf("unknown parameter %q, allowed parameters are %v", key, allowedParams(specs))}
+		}
+		if err := validateParameterValue(key, parameters[key], spec); err != nil {
+			return &InvalidParametersError{Backend: backend, Reason: err.Error()}
+		}
+	}
+	for _, key := range allowedParams(specs) {
+		if _, exists := parameters[key]; !exists && specs[key].required {
+			return &InvalidParametersError{Backend: backend, Reason: fmt.Sprintf("parameter %q is required", key)}
+		}
+	}
+	return nil
+}
+
+func validateParameterValue(key string, value string, spec paramSpec) error {
+	switch spec.valueType {
+	case paramTypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("parameter %q must be an %s, got %q", key, spec.valueType, value)
+		}
+	case paramTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("parameter %q must be a %s, got %q", key, spec.valueType, value)
+		}
+	}
+	if len(spec.allowedValues) == 0 {
+		return nil
+	}
+	for _, allowed := range spec.allowedValues {
+		if value == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("parameter %q has invalid value %q, allowed values are [%s]", key, value, strings.Join(spec.allowedValues, " "))
+}
+
+func allowedParams(specs map[string]paramSpec) []string {
+	keys := make([]string, 0, len(specs))
+	for key := range specs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func supportedBackends() []string {
+	backends := make([]string, 0, len(backendParams))
+	for backend := range backendParams {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends)
+	return backends
+}
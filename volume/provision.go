@@ -18,19 +18,27 @@ package volume
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	k8sresources "github.com/IBM/ubiquity-k8s/resources"
 	"github.com/IBM/ubiquity/resources"
 	"github.com/IBM/ubiquity/utils/logs"
 	"github.com/kubernetes-incubator/external-storage/lib/controller"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	"k8s.io/api/core/v1"
 	"net"
@@ -54,17 +62,45 @@ const (
 	// A PV annotation for the identity of the flexProvisioner that provisioned it
 	annProvisionerId = "Provisioner_Id"
 
-	podIPEnv     = "POD_IP"
-	serviceEnv   = "SERVICE_NAME"
-	namespaceEnv = "POD_NAMESPACE"
-	nodeEnv      = "NODE_NAME"
+	// The StorageClass annotation of PVCs that were created before PersistentVolumeClaimSpec.StorageClassName.
+	annStorageClass = "volume.beta.kubernetes.io/storage-class"
+
+	// The PVC annotation of the VolumeSnapshot to restore, from the snapshot provisioner of external-storage.
+	annSnapshot = "snapshot.alpha.kubernetes.io/snapshot"
+
+	// The StorageClass parameter of the filesystem type, it is also used by ubiquity to create the filesystem.
+	paramFsType = "fstype"
+
+	// The reasons of the events that the provisioner records on the PVCs and PVs.
+	ReasonVolumeCreated      = "VolumeCreated"
+	ReasonVolumeCreateFailed = "VolumeCreateFailed"
+	ReasonInvalidParameters  = "InvalidParameters"
+	ReasonVolumeDeleted      = "VolumeDeleted"
+	ReasonVolumeDeleteFailed = "VolumeDeleteFailed"
 )
 
-func NewFlexProvisioner(logger *log.Logger, ubiquityClient resources.StorageClient, config resources.UbiquityPluginConfig) (controller.Provisioner, error) {
-	return newFlexProvisionerInternal(logger, ubiquityClient, config)
+var (
+	// The backend activation is retried with an exponential backoff, until it succeeds.
+	activationInitialDelay = 2 * time.Second
+	activationMaxDelay     = 2 * time.Minute
+	// How long Provision waits for the backend activation before it fails, the provision controller retries it later.
+	activationWaitTimeout = time.Minute
+)
+
+// FlexProvisioner is the ubiquity Provisioner, it also reports whether its backends are activated.
+type FlexProvisioner interface {
+	controller.Provisioner
+	// CheckActivated returns the activation error, or nil if the backends are activated.
+	CheckActivated() error
+}
+
+// NewFlexProvisioner creates the provisioner, it records the volumes it creates in ownership.
+// Without a kubeClient and an ownership it never adopts an existing volume.
+func NewFlexProvisioner(logger *log.Logger, ubiquityClient resources.StorageClient, kubeClient kubernetes.Interface, ownership *VolumeOwnership, config resources.UbiquityPluginConfig) (FlexProvisioner, error) {
+	return newFlexProvisionerInternal(logger, ubiquityClient, kubeClient, ownership, config)
 }
 
-func newFlexProvisionerInternal(logger *log.Logger, ubiquityClient resources.StorageClient, config resources.UbiquityPluginConfig) (*flexProvisioner, error) {
+func newFlexProvisionerInternal(logger *log.Logger, ubiquityClient resources.StorageClient, kubeClient kubernetes.Interface, ownership *VolumeOwnership, config resources.UbiquityPluginConfig) (*flexProvisioner, error) {
 	var identity types.UID
 	identityPath := path.Join(config.LogPath, identityFile)
 	request_context := logs.GetNewRequestContext("Activate")
@@ -86,24 +122,56 @@ func newFlexProvisionerInternal(logger *log.Logger, ubiquityClient resources.Sto
 		identity:       identity,
 		ubiquityClient: ubiquityClient,
 		ubiquityConfig: config,
-		podIPEnv:       podIPEnv,
-		serviceEnv:     serviceEnv,
-		namespaceEnv:   namespaceEnv,
-		nodeEnv:        nodeEnv,
+		kubeClient:     kubeClient,
+		ownership:      ownership,
+		activated:      make(chan struct{}),
+	}
+	if kubeClient != nil {
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+		provisioner.eventRecorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: createdBy})
 	}
 
 	activateRequest := resources.ActivateRequest{Backends: config.Backends, Context: request_context}
 	logger.Printf("activating backend %s\n", config.Backends)
-	err := provisioner.ubiquityClient.Activate(activateRequest)
-
-	if err != nil {
+	if err := provisioner.activate(activateRequest); err != nil {
 		if isTimeOutError(err) {
 			// The log is here to advise the user on where to look for further information
-			logger.Printf("Cannot start ubiqutiy-k8s-provisioner due to failure of connectivity to Ubiquity pod.")
+			logger.Printf("Failed to activate the backends due to failure of connectivity to Ubiquity pod.")
 		}
+		// The provisioner starts degraded, so it does not crash loop while the ubiquity pod is not up yet.
+		logger.Printf("Failed to activate backend %s, retrying in the background: %v", config.Backends, err)
+		go provisioner.activateUntilSucceeded(activateRequest)
 	}
 
-	return provisioner, err
+	return provisioner, nil
+}
+
+func (p *flexProvisioner) activate(activateRequest resources.ActivateRequest) error {
+	start := time.Now()
+	err := p.ubiquityClient.Activate(activateRequest)
+	observeUbiquityCall("Activate", strings.Join(activateRequest.Backends, ","), "", start, err)
+	setBackendsActivated(activateRequest.Backends, err == nil)
+	p.setActivationError(err)
+	return err
+}
+
+// activateUntilSucceeded retries the backend activation with an exponential backoff.
+func (p *flexProvisioner) activateUntilSucceeded(activateRequest resources.ActivateRequest) {
+	delay := activationInitialDelay
+	for {
+		time.Sleep(delay)
+		err := p.activate(activateRequest)
+		if err == nil {
+			p.logger.Info("Backends activated", logs.Args{{"backends", activateRequest.Backends}})
+			return
+		}
+		delay *= 2
+		if delay > activationMaxDelay {
+			delay = activationMaxDelay
+		}
+		p.logger.Warning("Failed to activate the backends", logs.Args{{"backends", activateRequest.Backends}, {"error", err}, {"retry in", delay.String()}})
+	}
 }
 
 func isTimeOutError(err error) bool {
@@ -119,28 +187,90 @@ func isTimeOutError(err error) bool {
 	return false
 }
 
+// isTransportError returns true if the ubiquity call failed before a response was received, e.g. on a dial or client timeout,
+// a reset connection or an unexpected EOF. The call may have been done by ubiquity anyway, unlike a call that ubiquity rejected.
+func isTransportError(err error) bool {
+	if urlError, ok := err.(*url.Error); ok {
+		err = urlError.Err
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "Client.Timeout exceeded") || strings.Contains(message, "connection reset") || strings.HasSuffix(message, "EOF")
+}
+
 type flexProvisioner struct {
 	logger   logs.Logger
 	identity types.UID
-	// Whether the provisioner is running out of cluster and so cannot rely on
-	// the existence of any of the pod, service, namespace, node env variables.
-	outOfCluster bool
 
 	ubiquityClient resources.StorageClient
 	ubiquityConfig resources.UbiquityPluginConfig
+	kubeClient     kubernetes.Interface
+	ownership      *VolumeOwnership
+	eventRecorder  record.EventRecorder
+
+	activationLock sync.RWMutex
+	activationErr  error
+	// activated is closed once the backends are activated.
+	activated     chan struct{}
+	activatedOnce sync.Once
+}
+
+func (p *flexProvisioner) setActivationError(err error) {
+	p.activationLock.Lock()
+	defer p.activationLock.Unlock()
+	p.activationErr = err
+	if err == nil {
+		p.activatedOnce.Do(func() { close(p.activated) })
+	}
+}
+
+// waitForActivation waits for the backend activation, so a Provision call while the provisioner is degraded is delayed instead of failed.
+func (p *flexProvisioner) waitForActivation() error {
+	select {
+	case <-p.activated:
+		return nil
+	case <-time.After(activationWaitTimeout):
+		return p.CheckActivated()
+	}
+}
 
-	// Environment variables the provisioner pod needs valid values for in order to
-	// put a service cluster IP as the server of provisioned NFS PVs, passed in
-	// via downward API. If serviceEnv is set, namespaceEnv must be too.
-	podIPEnv     string
-	serviceEnv   string
-	namespaceEnv string
-	nodeEnv      string
+func (p *flexProvisioner) CheckActivated() error {
+	p.activationLock.RLock()
+	defer p.activationLock.RUnlock()
+	if p.activationErr != nil {
+		return fmt.Errorf("backends %v are not activated: %v", p.ubiquityConfig.Backends, p.activationErr)
+	}
+	return nil
 }
 
 // Provision creates a volume i.e. the storage asset and returns a PV object for
-// the volume.
+// the volume. The outcome is recorded as an event on the PVC, so the backend error is visible with kubectl describe pvc.
 func (p *flexProvisioner) Provision(options controller.VolumeOptions) (*v1.PersistentVolume, error) {
+	start := time.Now()
+	pv, err := p.provision(options)
+	storageClass := ""
+	if options.PVC != nil {
+		storageClass = getClaimClass(options.PVC)
+	}
+	observeProvision(options.Parameters[paramBackend], storageClass, start, err)
+	if options.PVC != nil {
+		if _, ok := err.(*InvalidParametersError); ok {
+			p.recordEvent(options.PVC, v1.EventTypeWarning, ReasonInvalidParameters, err.Error())
+		} else if err != nil {
+			p.recordEvent(options.PVC, v1.EventTypeWarning, ReasonVolumeCreateFailed, fmt.Sprintf("Failed to create volume %s: %v", options.PVName, err))
+		} else {
+			p.recordEvent(options.PVC, v1.EventTypeNormal, ReasonVolumeCreated, fmt.Sprintf("Successfully created volume %s", pv.Name))
+		}
+	}
+	return pv, err
+}
+
+func (p *flexProvisioner) provision(options controller.VolumeOptions) (*v1.PersistentVolume, error) {
 	request_context := logs.GetNewRequestContext("Provision")
 	go_id := logs.GetGoID()
 	logs.GoIdToRequestIdMap.Store(go_id, request_context)
@@ -149,6 +279,20 @@ func (p *flexProvisioner) Provision(options controller.VolumeOptions) (*v1.Persi
 	if options.PVC == nil {
 		return nil, fmt.Errorf("options missing PVC %#v", options)
 	}
+	if options.PVC.Spec.VolumeMode != nil && *options.PVC.Spec.VolumeMode == v1.PersistentVolumeBlock {
+		// The kubelet flex plugin can only mount a filesystem into the pod, it cannot expose a raw block device yet.
+		return nil, p.logger.ErrorRet(fmt.Errorf("volumeMode %s is not supported yet by the flex driver, only %s volumes can be provisioned", v1.PersistentVolumeBlock, v1.PersistentVolumeFilesystem), "failed")
+	}
+	if snapshot, ok := options.PVC.Annotations[annSnapshot]; ok {
+		// Ubiquity cannot snapshot volumes yet, so fail instead of provisioning an empty volume for the restore.
+		return nil, p.logger.ErrorRet(fmt.Errorf("restoring snapshot %s is not supported yet, ubiquity cannot snapshot volumes", snapshot), "failed")
+	}
+	if err := validateParameters(options.Parameters); err != nil {
+		return nil, p.logger.ErrorRet(err, "failed")
+	}
+	if err := p.waitForActivation(); err != nil {
+		return nil, p.logger.ErrorRet(err, "failed")
+	}
 
 	// override volume name according to label
 	pvName, ok := options.PVC.Labels["pv-name"]
@@ -160,14 +304,19 @@ func (p *flexProvisioner) Provision(options controller.VolumeOptions) (*v1.Persi
 	if !exists {
 		return nil, fmt.Errorf("options.PVC.Spec.Resources.Requests does not contain capacity")
 	}
-	msg := fmt.Sprintf("PVC with capacity %d.", capacity.Value())
+	backend := options.Parameters[paramBackend]
+	capacityMB := roundUpCapacity(capacity.Value(), backend) / mib
+	msg := fmt.Sprintf("PVC with capacity %d, rounded up to %dMB for backend %s.", capacity.Value(), capacityMB, backend)
 	p.logger.Info(msg)
-	capacityMB := capacity.Value() / (1024 * 1024)
 
 	volume_details, err := p.createVolume(options, capacityMB, request_context)
 	if err != nil {
 		return nil, err
 	}
+	if len(options.MountOptions) > 0 {
+		// The flex plugin of kubelet does not support the PV mountOptions, so the flex mount call gets them in the FlexVolumeSource options.
+		volume_details[k8sresources.OptionNameForMountOptions] = strings.Join(options.MountOptions, ",")
+	}
 
 	annotations := make(map[string]string)
 	annotations[annCreatedBy] = createdBy
@@ -183,14 +332,14 @@ func (p *flexProvisioner) Provision(options controller.VolumeOptions) (*v1.Persi
 			PersistentVolumeReclaimPolicy: options.PersistentVolumeReclaimPolicy,
 			AccessModes:                   options.PVC.Spec.AccessModes,
 			Capacity: v1.ResourceList{
-				v1.ResourceName(v1.ResourceStorage): options.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)],
+				v1.ResourceName(v1.ResourceStorage): provisionedCapacity(volume_details, backend, capacity.Value()),
 			},
 			PersistentVolumeSource: v1.PersistentVolumeSource{
 				FlexVolume: &v1.FlexVolumeSource{
 					Driver:    k8sresources.UbiquityK8sFlexVolumeDriverFullName,
-					FSType:    "",
+					FSType:    options.Parameters[paramFsType],
 					SecretRef: nil,
-					ReadOnly:  false,
+					ReadOnly:  isReadOnlyAccessModes(options.PVC.Spec.AccessModes),
 					Options:   volume_details,
 				},
 			},
@@ -200,9 +349,38 @@ func (p *flexProvisioner) Provision(options controller.VolumeOptions) (*v1.Persi
 	return pv, nil
 }
 
+// isReadOnlyAccessModes returns true if the claim can only be mounted read-only,
+// so kubelet will ask the flex to mount the PV read-only.
+func isReadOnlyAccessModes(accessModes []v1.PersistentVolumeAccessMode) bool {
+	if len(accessModes) == 0 {
+		return false
+	}
+	for _, accessMode := range accessModes {
+		if accessMode != v1.ReadOnlyMany {
+			return false
+		}
+	}
+	return true
+}
+
 // Delete removes the directory that was created by Provision backing the given
-// PV.
+// PV. The outcome is recorded as an event on the PV.
 func (p *flexProvisioner) Delete(volume *v1.PersistentVolume) error {
+	start := time.Now()
+	backend, err := p.deleteVolume(volume)
+	observeDelete(backend, volume.Spec.StorageClassName, start, err)
+	if volume.Name != "" {
+		if err != nil {
+			p.recordEvent(volume, v1.EventTypeWarning, ReasonVolumeDeleteFailed, fmt.Sprintf("Failed to delete volume %s: %v", volume.Name, err))
+		} else if volume.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimRetain {
+			p.recordEvent(volume, v1.EventTypeNormal, ReasonVolumeDeleted, fmt.Sprintf("Successfully deleted volume %s", volume.Name))
+		}
+	}
+	return err
+}
+
+// deleteVolume removes the backend volume of the PV and returns its backend, which is empty if the volume was not found.
+func (p *flexProvisioner) deleteVolume(volume *v1.PersistentVolume) (string, error) {
 	requestContext := logs.GetNewRequestContext("Delete")
 	go_id := logs.GetGoID()
 	logs.GoIdToRequestIdMap.Store(go_id, requestContext)
@@ -210,32 +388,37 @@ func (p *flexProvisioner) Delete(volume *v1.PersistentVolume) error {
 	defer p.logger.Trace(logs.DEBUG, logs.Args{{"volume name", volume.Name}})()
 
 	if volume.Name == "" {
-		return fmt.Errorf("volume name cannot be empty %#v", volume)
+		return "", fmt.Errorf("volume name cannot be empty %#v", volume)
 	}
 
 	if volume.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimRetain {
+		storageClass := volume.Spec.StorageClassName
 		getVolumeRequest := resources.GetVolumeRequest{Name: volume.Name, Context: requestContext}
-		volume, err := p.ubiquityClient.GetVolume(getVolumeRequest)
+		start := time.Now()
+		ubiquityVolume, err := p.ubiquityClient.GetVolume(getVolumeRequest)
+		observeUbiquityCall("GetVolume", ubiquityVolume.Backend, storageClass, start, err)
 		if err != nil {
 			if strings.Contains(err.Error(), resources.VolumeNotFoundErrorMsg) {
 				p.logger.Warning("Idempotent issue while deleting volume : volume was not found in ubiquity DB", logs.Args{{"volume name", volume.Name}})
-				return nil
+				return "", p.removeOwnership(volume.Name)
 			} else {
-				return p.logger.ErrorRet(err, "error retreiving volume  information.", logs.Args{{"volume name", volume.Name}})
+				return "", p.logger.ErrorRet(err, "error retreiving volume  information.", logs.Args{{"volume name", volume.Name}})
 			}
 		}
 
 		removeVolumeRequest := resources.RemoveVolumeRequest{Name: volume.Name, Context: requestContext}
+		start = time.Now()
 		err = p.ubiquityClient.RemoveVolume(removeVolumeRequest)
+		observeUbiquityCall("RemoveVolume", ubiquityVolume.Backend, storageClass, start, err)
 		if err != nil {
 			p.logger.Info("error removing volume")
-			return err
+			return ubiquityVolume.Backend, err
 		}
-		return nil
+		return ubiquityVolume.Backend, p.removeOwnership(volume.Name)
 
 	}
 
-	return nil
+	return "", nil
 }
 
 func (p *flexProvisioner) createVolume(options controller.VolumeOptions, capacity int64, requestContext resources.RequestContext) (map[string]string, error) {
@@ -254,17 +437,57 @@ func (p *flexProvisioner) createVolume(options controller.VolumeOptions, capacit
 		return nil, fmt.Errorf("backend is not specified")
 	}
 	b := backendName.(string)
-	createVolumeRequest := resources.CreateVolumeRequest{Name: options.PVName, Backend: b, Opts: ubiquityParams, Context: requestContext}
-	err := p.ubiquityClient.CreateVolume(createVolumeRequest)
+	storageClass := getClaimClass(options.PVC)
+
+	// A previous call may have created the volume and then failed or timed out, so an existing volume is adopted instead of created again.
+	existingVolume, err := p.getExistingVolume(options.PVName, storageClass, requestContext)
 	if err != nil {
-		return nil, fmt.Errorf("error creating volume: %v.", err)
+		return nil, fmt.Errorf("error checking for an existing volume: %v.", err)
+	}
+	if existingVolume != nil {
+		if existingVolume.Backend != b {
+			return nil, fmt.Errorf("volume %s already exists on backend %s, not on backend %s", options.PVName, existingVolume.Backend, b)
+		}
+		if err := p.checkAdoptable(options.PVName); err != nil {
+			return nil, fmt.Errorf("volume %s already exists and cannot be adopted: %v", options.PVName, err)
+		}
+		p.logger.Warning("Volume already exists, adopting it", logs.Args{{"volume name", options.PVName}, {"backend", b}})
+	} else {
+		// The volume is owned before it is created, so the next call adopts a volume that this call created before it timed out.
+		if p.ownership != nil {
+			if err := p.ownership.Add(options.PVName, options.PersistentVolumeReclaimPolicy); err != nil {
+				return nil, fmt.Errorf("error recording the ownership of the volume: %v.", err)
+			}
+		}
+		createVolumeRequest := resources.CreateVolumeRequest{Name: options.PVName, Backend: b, Opts: ubiquityParams, Context: requestContext}
+		start := time.Now()
+		err := p.ubiquityClient.CreateVolume(createVolumeRequest)
+		observeUbiquityCall("CreateVolume", b, storageClass, start, err)
+		if err != nil {
+			// After a transport error ubiquity may have created the volume, so the ownership is kept for the next call to adopt it.
+			if !isTransportError(err) {
+				p.removeOwnership(options.PVName)
+			}
+			return nil, fmt.Errorf("error creating volume: %v.", err)
+		}
 	}
 
 	getVolumeConfigRequest := resources.GetVolumeConfigRequest{Name: options.PVName, Context: requestContext}
+	start := time.Now()
 	volumeConfig, err := p.ubiquityClient.GetVolumeConfig(getVolumeConfigRequest)
+	observeUbiquityCall("GetVolumeConfig", b, storageClass, start, err)
 	if err != nil {
+		// After a transport error the next call adopts the volume, a rejection by ubiquity is definitive so the volume this call created is removed.
+		if existingVolume == nil && !isTransportError(err) {
+			p.removeCreatedVolume(options.PVName, b, storageClass, requestContext)
+		}
 		return nil, fmt.Errorf("error getting volume config details: %v ", err)
 	}
+	if existingVolume != nil {
+		if err := checkVolumeConfig(volumeConfig, b, options.Parameters, capacity*mib); err != nil {
+			return nil, fmt.Errorf("volume %s already exists and cannot be adopted: %v", options.PVName, err)
+		}
+	}
 
 	flexVolumeConfig := make(map[string]string)
 	flexVolumeConfig["volumeName"] = options.PVName
@@ -274,3 +497,107 @@ func (p *flexProvisioner) createVolume(options controller.VolumeOptions, capacit
 
 	return flexVolumeConfig, nil
 }
+
+// getExistingVolume returns the volume with the name, or nil if ubiquity does not know it.
+func (p *flexProvisioner) getExistingVolume(name string, storageClass string, requestContext resources.RequestContext) (*resources.Volume, error) {
+	start := time.Now()
+	volume, err := p.ubiquityClient.GetVolume(resources.GetVolumeRequest{Name: name, Context: requestContext})
+	observeUbiquityCall("GetVolume", volume.Backend, storageClass, start, err)
+	if err != nil {
+		if strings.Contains(err.Error(), resources.VolumeNotFoundErrorMsg) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if volume.Name != name {
+		return nil, nil
+	}
+	return &volume, nil
+}
+
+// checkAdoptable returns an error unless the provisioner owns the volume and no PV uses it,
+// so a PVC cannot take over a volume of another PVC, of another cluster or of the docker plugin.
+func (p *flexProvisioner) checkAdoptable(name string) error {
+	if p.kubeClient == nil || p.ownership == nil {
+		return fmt.Errorf("its ownership cannot be verified")
+	}
+	_, owned, err := p.ownership.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting its ownership: %v", err)
+	}
+	if !owned {
+		return fmt.Errorf("it was not created by the provisioner")
+	}
+	pvName, err := findVolumePV(p.kubeClient, name)
+	if err != nil {
+		return fmt.Errorf("error listing the PVs: %v", err)
+	}
+	if pvName != "" {
+		return fmt.Errorf("it is used by PV %s", pvName)
+	}
+	return nil
+}
+
+// checkVolumeConfig returns an error if the config of an existing volume does not match the StorageClass parameters,
+// or if the volume is smaller than requested.
+func checkVolumeConfig(volumeConfig map[string]interface{}, backend string, parameters map[string]string, requestedBytes int64) error {
+	for key, value := range parameters {
+		if key == paramBackend {
+			continue
+		}
+		if configValue, exists := volumeConfig[key]; exists && fmt.Sprintf("%v", configValue) != value {
+			return fmt.Errorf("its %s is %v, not %s", key, configValue, value)
+		}
+	}
+	if capacity, ok := backendCapacities[backend]; ok {
+		if configValue, exists := volumeConfig[capacity.configKey]; exists {
+			if size, ok := parseCapacity(fmt.Sprintf("%v", configValue), capacity.configUnit); ok && size < requestedBytes {
+				return fmt.Errorf("its %s is %v, smaller than the requested %d bytes", capacity.configKey, configValue, requestedBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// removeCreatedVolume removes a volume that was created by a failed Provision call, so it does not leak on the backend.
+func (p *flexProvisioner) removeCreatedVolume(name string, backend string, storageClass string, requestContext resources.RequestContext) {
+	p.logger.Warning("Removing the volume that was created by the failed provision", logs.Args{{"volume name", name}})
+	start := time.Now()
+	err := p.ubiquityClient.RemoveVolume(resources.RemoveVolumeRequest{Name: name, Context: requestContext})
+	observeUbiquityCall("RemoveVolume", backend, storageClass, start, err)
+	if err != nil {
+		p.logger.Error("Failed to remove the volume that was created by the failed provision", logs.Args{{"volume name", name}, {"error", err}})
+		return
+	}
+	p.removeOwnership(name)
+}
+
+// removeOwnership forgets a volume that was removed or never created, the failure is also logged.
+func (p *flexProvisioner) removeOwnership(name string) error {
+	if p.ownership == nil {
+		return nil
+	}
+	if err := p.ownership.Remove(name); err != nil {
+		return p.logger.ErrorRet(err, "failed to remove the ownership of the volume", logs.Args{{"volume name", name}})
+	}
+	return nil
+}
+
+// getClaimClass returns the StorageClass of the PVC, from its spec or from the beta annotation of older PVCs.
+func getClaimClass(claim *v1.PersistentVolumeClaim) string {
+	if class, found := claim.Annotations[annStorageClass]; found {
+		return class
+	}
+	if claim.Spec.StorageClassName != nil {
+		return *claim.Spec.StorageClassName
+	}
+	return ""
+}
+
+// recordEvent records an event on the PVC or PV, it does nothing if the provisioner has no kubernetes client.
+func (p *flexProvisioner) recordEvent(object runtime.Object, eventType string, reason string, message string) {
+	if p.eventRecorder == nil {
+		return
+	}
+	p.eventRecorder.Event(object, eventType, reason, message)
+}
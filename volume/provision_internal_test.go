@@ -0,0 +1,102 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/IBM/ubiquity/fakes"
+	"github.com/IBM/ubiquity/resources"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("provision_internal_tests", func() {
+	var (
+		fakeClient                                                   *fakes.FakeStorageClient
+		logger                                                       *log.Logger
+		config                                                       resources.UbiquityPluginConfig
+		options                                                      controller.VolumeOptions
+		savedInitialDelay, savedMaxDelay, savedActivationWaitTimeout time.Duration
+	)
+
+	BeforeEach(func() {
+		savedInitialDelay, savedMaxDelay, savedActivationWaitTimeout = activationInitialDelay, activationMaxDelay, activationWaitTimeout
+		activationInitialDelay, activationMaxDelay, activationWaitTimeout = 10*time.Millisecond, 20*time.Millisecond, 5*time.Second
+		fakeClient = new(fakes.FakeStorageClient)
+		logger = log.New(ioutil.Discard, "provisioner: ", log.LstdFlags)
+		config = resources.UbiquityPluginConfig{Backends: []string{resources.SCBE}, LogPath: "/tmp"}
+		options = controller.VolumeOptions{
+			PVName:     "fakepv",
+			Parameters: map[string]string{"backend": resources.SCBE},
+			PVC: &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{
+				Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}},
+			}},
+		}
+	})
+
+	AfterEach(func() {
+		// Stop the background activation of the provisioners that are still degraded.
+		fakeClient.ActivateReturns(nil)
+		activationInitialDelay, activationMaxDelay, activationWaitTimeout = savedInitialDelay, savedMaxDelay, savedActivationWaitTimeout
+	})
+
+	Context(".activateUntilSucceeded", func() {
+		It("starts degraded and retries the activation until it succeeds", func() {
+			fakeClient.ActivateReturnsOnCall(0, fmt.Errorf("connection refused"))
+			fakeClient.ActivateReturnsOnCall(1, fmt.Errorf("connection refused"))
+
+			provisioner, err := newFlexProvisionerInternal(logger, fakeClient, nil, nil, config)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(provisioner.CheckActivated()).To(MatchError(ContainSubstring("connection refused")))
+			Eventually(provisioner.CheckActivated).Should(Succeed())
+			Expect(fakeClient.ActivateCallCount()).To(Equal(3))
+		})
+	})
+
+	Context(".Provision while degraded", func() {
+		It("waits for the activation instead of failing", func() {
+			fakeClient.ActivateReturnsOnCall(0, fmt.Errorf("connection refused"))
+			provisioner, err := newFlexProvisionerInternal(logger, fakeClient, nil, nil, config)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.ActivateCallCount()).To(Equal(2))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(1))
+		})
+		It("fails without creating the volume if the activation does not succeed in time", func() {
+			activationWaitTimeout = 50 * time.Millisecond
+			fakeClient.ActivateReturns(fmt.Errorf("connection refused"))
+			provisioner, err := newFlexProvisionerInternal(logger, fakeClient, nil, nil, config)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring("not activated")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+	})
+})
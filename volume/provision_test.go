@@ -18,7 +18,15 @@ package volume_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
 	"github.com/IBM/ubiquity-k8s/volume"
 	"github.com/IBM/ubiquity/fakes"
 	"github.com/IBM/ubiquity/resources"
@@ -26,7 +34,9 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 )
 
 var _ = Describe("Provisioner", func() {
@@ -45,7 +55,7 @@ var _ = Describe("Provisioner", func() {
 		backends = []string{resources.SpectrumScale}
 		ubiquityConfig = resources.UbiquityPluginConfig{Backends: backends}
 		// fakeKubeInterface = new(k8s_fake.FakeInterface)
-		provisioner, err = volume.NewFlexProvisioner(testLogger, fakeClient, ubiquityConfig)
+		provisioner, err = volume.NewFlexProvisioner(testLogger, fakeClient, nil, nil, ubiquityConfig)
 	})
 
 	Context(".Provision", func() {
@@ -61,7 +71,381 @@ var _ = Describe("Provisioner", func() {
 			_, err = provisioner.Provision(options)
 			Expect(err).To(HaveOccurred())
 		})
+		It("fails to provision a raw block volume", func() {
+			blockVolumeMode := v1.PersistentVolumeBlock
+			options.PVC = &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{
+				VolumeMode: &blockVolumeMode,
+				Resources:  v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}},
+			}}
+			options.Parameters = map[string]string{"backend": resources.SCBE}
+			_, err = provisioner.Provision(options)
+			Expect(err).To(MatchError(ContainSubstring("volumeMode Block is not supported")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("fails to provision a PVC that restores a snapshot", func() {
+			options.PVC = &v1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"snapshot.alpha.kubernetes.io/snapshot": "snap1"}},
+				Spec: v1.PersistentVolumeClaimSpec{
+					Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}},
+				},
+			}
+			options.Parameters = map[string]string{"backend": resources.SCBE}
+			_, err = provisioner.Provision(options)
+			Expect(err).To(MatchError(ContainSubstring("restoring snapshot snap1 is not supported")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("records the failure as an event on the PVC", func() {
+			fakeKubeClient := k8sfake.NewSimpleClientset()
+			provisioner, err = volume.NewFlexProvisioner(testLogger, fakeClient, fakeKubeClient, nil, ubiquityConfig)
+			Expect(err).ToNot(HaveOccurred())
+			options.PVC = &v1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc1", Namespace: "default"},
+				Spec: v1.PersistentVolumeClaimSpec{
+					Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}},
+				},
+			}
+			options.Parameters = map[string]string{"backend": resources.SCBE, "profile": "gold"}
+			fakeClient.CreateVolumeReturns(fmt.Errorf("the backend has no free space"))
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			Eventually(func() []string {
+				events, _ := fakeKubeClient.CoreV1().Events("default").List(metav1.ListOptions{})
+				var reasons []string
+				for _, event := range events.Items {
+					reasons = append(reasons, event.Reason)
+				}
+				return reasons
+			}).Should(ContainElement(volume.ReasonVolumeCreateFailed))
+		})
+
+	})
+
+	Context(".Provision parameters", func() {
+		BeforeEach(func() {
+			options = controller.VolumeOptions{
+				PVName: "fakepv",
+				PVC: &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{
+					Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}},
+				}},
+			}
+		})
+		It("fails when the backend parameter is missing", func() {
+			options.Parameters = map[string]string{"profile": "gold"}
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring(`parameter "backend" is required`)))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("passes the parameters of a backend without a schema to ubiquity", func() {
+			options.Parameters = map[string]string{"backend": "nfs", "export": "/gold"}
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(1))
+			createVolumeRequest := fakeClient.CreateVolumeArgsForCall(0)
+			Expect(createVolumeRequest.Backend).To(Equal("nfs"))
+			Expect(createVolumeRequest.Opts["export"]).To(Equal("/gold"))
+		})
+		It("fails for an unknown parameter of the backend", func() {
+			options.Parameters = map[string]string{"backend": resources.SCBE, "fstpe": "xfs"}
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring(`unknown parameter "fstpe"`)))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("fails for a value that is not allowed", func() {
+			options.Parameters = map[string]string{"backend": resources.SCBE, "fstype": "btrfs"}
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring(`parameter "fstype" has invalid value "btrfs"`)))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("fails for a value of the wrong type", func() {
+			options.Parameters = map[string]string{"backend": resources.SpectrumScale, "uid": "root"}
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring(`parameter "uid" must be an integer`)))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("creates the volume when the parameters are valid", func() {
+			options.Parameters = map[string]string{"backend": resources.SpectrumScale, "filesystem": "gold", "type": "fileset", "uid": "1000", "isPreexisting": "false"}
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(1))
+		})
+		It("accepts the parameters of the StorageClasses of the helm chart", func() {
+			storageClasses, err := filepath.Glob("../helm_chart/ibm-storage-enabler-for-containers-dev/templates/storage-class*.yaml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(storageClasses).ToNot(BeEmpty())
+			for _, storageClass := range storageClasses {
+				options.Parameters = readStorageClassParameters(storageClass)
+
+				_, err = provisioner.Provision(options)
+
+				Expect(err).ToNot(HaveOccurred(), storageClass)
+			}
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(len(storageClasses)))
+		})
+	})
+
+	Context(".Provision capacity", func() {
+		BeforeEach(func() {
+			options = controller.VolumeOptions{PVName: "fakepv", PVC: &v1.PersistentVolumeClaim{}}
+		})
+		It("rounds up the capacity to whole GB for scbe", func() {
+			options.PVC.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("500Mi")}
+			options.Parameters = map[string]string{"backend": resources.SCBE}
+
+			pv, err := provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			createVolumeRequest := fakeClient.CreateVolumeArgsForCall(0)
+			Expect(createVolumeRequest.Opts["size"]).To(Equal("1"))
+			capacity := pv.Spec.Capacity[v1.ResourceStorage]
+			Expect(capacity.Cmp(k8sresource.MustParse("1Gi"))).To(Equal(0))
+		})
+		It("rounds up the capacity to whole MB for spectrum-scale", func() {
+			options.PVC.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1500Ki")}
+			options.Parameters = map[string]string{"backend": resources.SpectrumScale}
+
+			pv, err := provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			createVolumeRequest := fakeClient.CreateVolumeArgsForCall(0)
+			Expect(createVolumeRequest.Opts["quota"]).To(Equal("2M"))
+			capacity := pv.Spec.Capacity[v1.ResourceStorage]
+			Expect(capacity.Cmp(k8sresource.MustParse("2Mi"))).To(Equal(0))
+		})
+		It("reports the size that the backend allocated on the PV", func() {
+			options.PVC.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}
+			options.Parameters = map[string]string{"backend": resources.SCBE}
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"size": 2}, nil)
+
+			pv, err := provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			capacity := pv.Spec.Capacity[v1.ResourceStorage]
+			Expect(capacity.Cmp(k8sresource.MustParse("2Gi"))).To(Equal(0))
+		})
+		It("ignores a reported size that is smaller than the request", func() {
+			options.PVC.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("2Gi")}
+			options.Parameters = map[string]string{"backend": resources.SCBE}
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"size": 1}, nil)
+
+			pv, err := provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			capacity := pv.Spec.Capacity[v1.ResourceStorage]
+			Expect(capacity.Cmp(k8sresource.MustParse("2Gi"))).To(Equal(0))
+		})
+	})
+
+	Context(".Provision idempotency", func() {
+		var (
+			fakeKubeClient *k8sfake.Clientset
+			ownership      *volume.VolumeOwnership
+		)
+		BeforeEach(func() {
+			fakeKubeClient = k8sfake.NewSimpleClientset()
+			ownership = volume.NewVolumeOwnership(fakeKubeClient, "ubiquity", "ubiquity-k8s-provisioner-volumes")
+			provisioner, err = volume.NewFlexProvisioner(testLogger, fakeClient, fakeKubeClient, ownership, ubiquityConfig)
+			Expect(err).ToNot(HaveOccurred())
+			options = controller.VolumeOptions{
+				PVName:                        "fakepv",
+				PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete,
+				Parameters:                    map[string]string{"backend": resources.SCBE, "profile": "gold"},
+				PVC: &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{
+					Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: k8sresource.MustParse("1Gi")}},
+				}},
+			}
+		})
+		It("records the ownership of the volume it creates", func() {
+			_, err = provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(1))
+			reclaimPolicy, owned, err := ownership.Get("fakepv")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeTrue())
+			Expect(reclaimPolicy).To(Equal(v1.PersistentVolumeReclaimDelete))
+		})
+		It("adopts an existing volume with the same backend and parameters instead of creating it", func() {
+			Expect(ownership.Add("fakepv", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "fakepv", Backend: resources.SCBE}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"profile": "gold", "size": "1"}, nil)
+
+			pv, err := provisioner.Provision(options)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pv.Name).To(Equal("fakepv"))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("fails without adopting an existing volume that the provisioner does not own", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "fakepv", Backend: resources.SCBE}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"profile": "gold", "size": "1"}, nil)
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring("it was not created by the provisioner")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+		})
+		It("fails without adopting an existing volume that a PV uses", func() {
+			Expect(ownership.Add("fakepv", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+			_, err = fakeKubeClient.CoreV1().PersistentVolumes().Create(&v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "otherpv"},
+				Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+					Driver:  k8sresources.UbiquityK8sFlexVolumeDriverFullName,
+					Options: map[string]string{"volumeName": "fakepv"},
+				}}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "fakepv", Backend: resources.SCBE}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"profile": "gold", "size": "1"}, nil)
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring("it is used by PV otherpv")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("fails without adopting an existing volume when the provisioner has no ownership", func() {
+			provisioner, err = volume.NewFlexProvisioner(testLogger, fakeClient, nil, nil, ubiquityConfig)
+			Expect(err).ToNot(HaveOccurred())
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "fakepv", Backend: resources.SCBE}, nil)
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring("cannot be adopted")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("fails when an existing volume is on another backend", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "fakepv", Backend: resources.SpectrumScale}, nil)
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring("already exists on backend")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("fails without removing an existing volume with other parameters", func() {
+			Expect(ownership.Add("fakepv", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "fakepv", Backend: resources.SCBE}, nil)
+			fakeClient.GetVolumeConfigReturns(map[string]interface{}{"profile": "silver"}, nil)
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(MatchError(ContainSubstring("cannot be adopted")))
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+		})
+		It("fails when the existing volume cannot be looked up", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{}, fmt.Errorf("connection refused"))
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(0))
+		})
+		It("removes the ownership when the volume creation fails", func() {
+			fakeClient.CreateVolumeReturns(fmt.Errorf("error creating volume"))
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			_, owned, err := ownership.Get("fakepv")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeFalse())
+		})
+		It("keeps the ownership when the volume creation times out", func() {
+			fakeClient.CreateVolumeReturns(&url.Error{Op: "Post", URL: "https://ubiquity", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ETIMEDOUT)}})
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			_, owned, err := ownership.Get("fakepv")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeTrue())
+		})
+		It("keeps the ownership when the volume creation exceeds the client timeout", func() {
+			fakeClient.CreateVolumeReturns(&url.Error{Op: "Post", URL: "https://ubiquity", Err: fmt.Errorf("net/http: request canceled (Client.Timeout exceeded while awaiting headers)")})
 
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			_, owned, err := ownership.Get("fakepv")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeTrue())
+		})
+		It("keeps the created volume and its ownership when getting its config fails on a reset connection", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{}, &resources.VolumeNotFoundError{"fakepv"})
+			fakeClient.GetVolumeConfigReturns(nil, &url.Error{Op: "Get", URL: "https://ubiquity", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}})
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(1))
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+			_, owned, err := ownership.Get("fakepv")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeTrue())
+		})
+		It("removes the created volume and its ownership when getting its config fails", func() {
+			fakeClient.GetVolumeReturns(resources.Volume{}, &resources.VolumeNotFoundError{"fakepv"})
+			fakeClient.GetVolumeConfigReturns(nil, fmt.Errorf("error getting volume config"))
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			Expect(fakeClient.CreateVolumeCallCount()).To(Equal(1))
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(1))
+			Expect(fakeClient.RemoveVolumeArgsForCall(0).Name).To(Equal("fakepv"))
+			_, owned, err := ownership.Get("fakepv")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeFalse())
+		})
+		It("does not remove an adopted volume when getting its config fails", func() {
+			Expect(ownership.Add("fakepv", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "fakepv", Backend: resources.SCBE}, nil)
+			fakeClient.GetVolumeConfigReturns(nil, fmt.Errorf("error getting volume config"))
+
+			_, err = provisioner.Provision(options)
+
+			Expect(err).To(HaveOccurred())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+		})
+		It("removes the ownership of a deleted volume", func() {
+			Expect(ownership.Add("vol1", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+			fakeClient.GetVolumeReturns(resources.Volume{Name: "vol1", Backend: resources.SCBE}, nil)
+
+			err = provisioner.Delete(&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "vol1"}})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(1))
+			_, owned, err := ownership.Get("vol1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeFalse())
+		})
+		It("removes the ownership of a volume that ubiquity does not know", func() {
+			Expect(ownership.Add("vol1", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+			Expect(ownership.Add("vol2", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+			fakeClient.GetVolumeReturns(resources.Volume{}, &resources.VolumeNotFoundError{"vol1"})
+
+			err = provisioner.Delete(&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "vol1"}})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+			volumes, err := ownership.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(volumes).To(Equal(map[string]v1.PersistentVolumeReclaimPolicy{"vol2": v1.PersistentVolumeReclaimDelete}))
+		})
 	})
 
 	Context(".Delete", func() {
@@ -101,3 +485,45 @@ var _ = Describe("Provisioner", func() {
 
 	})
 })
+
+// helmValueSamples holds a valid value for each StorageClass parameter that the helm chart takes from its values.
+var helmValueSamples = map[string]string{
+	"profile":    "gold",
+	"fstype":     "ext4",
+	"filesystem": "gold",
+}
+
+// readStorageClassParameters returns the parameters of a StorageClass template of the helm chart,
+// with a sample value for the parameters that are set from the values of the chart.
+func readStorageClassParameters(path string) map[string]string {
+	content, err := ioutil.ReadFile(path)
+	Expect(err).ToNot(HaveOccurred())
+	parameters := make(map[string]string)
+	inParameters := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "parameters:") {
+			inParameters = true
+			continue
+		}
+		if !inParameters {
+			continue
+		}
+		if !strings.HasPrefix(line, "  ") {
+			break
+		}
+		keyValue := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		Expect(keyValue).To(HaveLen(2), path)
+		key, value := keyValue[0], keyValue[1]
+		if i := strings.Index(value, "#"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if strings.HasPrefix(value, "{{") {
+			sample, ok := helmValueSamples[key]
+			Expect(ok).To(BeTrue(), "no sample value of the templated parameter %s of %s", key, path)
+			value = sample
+		}
+		parameters[key] = value
+	}
+	return parameters
+}
@@ -0,0 +1,213 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/ubiquity/resources"
+	"github.com/IBM/ubiquity/utils/logs"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// The reasons of the events that the reconciler records for the drift between ubiquity and the PVs.
+	ReasonOrphanVolume        = "OrphanVolume"
+	ReasonOrphanVolumeDeleted = "OrphanVolumeDeleted"
+	ReasonVolumeMissing       = "VolumeMissing"
+)
+
+// ReconcileReport is the drift that a reconcile found between the ubiquity volumes and the PVs of the flex driver.
+type ReconcileReport struct {
+	// OrphanVolumes are the ubiquity volumes that no PV uses.
+	OrphanVolumes []string
+	// MissingVolumes are the PVs whose volume ubiquity does not know.
+	MissingVolumes []string
+	// DeletedVolumes are the orphan volumes that were deleted, because they were orphans for longer than the grace period.
+	DeletedVolumes []string
+}
+
+// FlexReconciler compares the ubiquity volumes with the PVs of the flex driver and reports the drift as events and metrics.
+// If deleteOrphans is set, a volume that stays an orphan for the grace period is deleted, if the provisioner owns it
+// with the Delete reclaim policy. The other orphans, such as the volumes of the docker plugin, of other clusters or of
+// retained PVs, are only reported. The grace period also covers a volume that is being provisioned, whose PV is not created yet.
+type FlexReconciler struct {
+	logger         logs.Logger
+	kubeClient     kubernetes.Interface
+	ubiquityClient resources.StorageClient
+	ownership      *VolumeOwnership
+	eventRecorder  record.EventRecorder
+	deleteOrphans  bool
+	gracePeriod    time.Duration
+
+	lock sync.Mutex
+	// orphanSince holds when each orphan volume was first found, it is forgotten once a PV uses the volume again.
+	orphanSince map[string]time.Time
+}
+
+func NewFlexReconciler(kubeClient kubernetes.Interface, ubiquityClient resources.StorageClient, ownership *VolumeOwnership, deleteOrphans bool, gracePeriod time.Duration) *FlexReconciler {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return &FlexReconciler{
+		logger:         logs.GetLogger(),
+		kubeClient:     kubeClient,
+		ubiquityClient: ubiquityClient,
+		ownership:      ownership,
+		eventRecorder:  broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: createdBy}),
+		deleteOrphans:  deleteOrphans,
+		gracePeriod:    gracePeriod,
+		orphanSince:    make(map[string]time.Time),
+	}
+}
+
+// Run reconciles every period until stopCh is closed.
+func (r *FlexReconciler) Run(period time.Duration, stopCh <-chan struct{}) {
+	defer r.logger.Trace(logs.INFO)()
+
+	wait.Until(func() {
+		if _, err := r.Reconcile(); err != nil {
+			r.logger.Error("Failed to reconcile the volumes", logs.Args{{"error", err}})
+		}
+	}, period, stopCh)
+}
+
+// Reconcile compares the ubiquity volumes with the PVs of the flex driver once.
+func (r *FlexReconciler) Reconcile() (ReconcileReport, error) {
+	requestContext := logs.GetNewRequestContext("Reconcile")
+	go_id := logs.GetGoID()
+	logs.GoIdToRequestIdMap.Store(go_id, requestContext)
+	defer logs.GetDeleteFromMapFunc(go_id)
+	defer r.logger.Trace(logs.DEBUG)()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report := ReconcileReport{}
+	start := time.Now()
+	volumes, err := r.ubiquityClient.ListVolumes(resources.ListVolumesRequest{Context: requestContext})
+	observeUbiquityCall("ListVolumes", "", "", start, err)
+	if err != nil {
+		return report, r.logger.ErrorRet(err, "failed to list the ubiquity volumes")
+	}
+	pvs, err := r.kubeClient.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return report, r.logger.ErrorRet(err, "failed to list the PVs")
+	}
+	if err := r.ownership.Sync(pvs.Items); err != nil {
+		return report, r.logger.ErrorRet(err, "failed to record the ownership of the provisioned volumes")
+	}
+	owned, err := r.ownership.List()
+	if err != nil {
+		return report, r.logger.ErrorRet(err, "failed to list the owned volumes")
+	}
+
+	volumeBackends := make(map[string]string)
+	for _, volume := range volumes {
+		volumeBackends[volume.Name] = volume.Backend
+	}
+	pvVolumes := make(map[string]bool)
+	missingByStorageClass := make(map[string]int)
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		volumeName := getFlexVolumeName(pv)
+		if volumeName == "" {
+			continue
+		}
+		pvVolumes[volumeName] = true
+		if _, exists := volumeBackends[volumeName]; !exists {
+			report.MissingVolumes = append(report.MissingVolumes, pv.Name)
+			missingByStorageClass[pv.Spec.StorageClassName]++
+			r.logger.Warning("The volume of the PV is not known to ubiquity", logs.Args{{"pv", pv.Name}, {"volume name", volumeName}})
+			r.eventRecorder.Event(pv, v1.EventTypeWarning, ReasonVolumeMissing, fmt.Sprintf("Volume %s of the PV is not known to ubiquity", volumeName))
+		}
+	}
+
+	now := time.Now()
+	orphansByBackend := make(map[string]int)
+	for name := range r.orphanSince {
+		if _, exists := volumeBackends[name]; !exists || pvVolumes[name] {
+			delete(r.orphanSince, name)
+		}
+	}
+	for _, volume := range volumes {
+		if pvVolumes[volume.Name] {
+			continue
+		}
+		since, known := r.orphanSince[volume.Name]
+		if !known {
+			since = now
+			r.orphanSince[volume.Name] = now
+		}
+		// There is no PV to record the event on, so the event refers to the PV that would have the volume name.
+		orphanPV := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: volume.Name}}
+		// Only the volumes that the provisioner created for a PV with the Delete reclaim policy are deleted.
+		if r.deleteOrphans && now.Sub(since) >= r.gracePeriod && owned[volume.Name] == v1.PersistentVolumeReclaimDelete {
+			if err := r.deleteOrphan(volume, requestContext); err != nil {
+				r.eventRecorder.Event(orphanPV, v1.EventTypeWarning, ReasonOrphanVolume, fmt.Sprintf("Failed to delete orphan volume %s of backend %s: %v", volume.Name, volume.Backend, err))
+			} else {
+				delete(r.orphanSince, volume.Name)
+				report.DeletedVolumes = append(report.DeletedVolumes, volume.Name)
+				orphanVolumesDeleted.WithLabelValues(volume.Backend).Inc()
+				r.eventRecorder.Event(orphanPV, v1.EventTypeNormal, ReasonOrphanVolumeDeleted, fmt.Sprintf("Deleted orphan volume %s of backend %s, no PV used it since %s", volume.Name, volume.Backend, since.Format(time.RFC3339)))
+				continue
+			}
+		} else if !known {
+			r.eventRecorder.Event(orphanPV, v1.EventTypeWarning, ReasonOrphanVolume, fmt.Sprintf("Volume %s of backend %s is not used by any PV", volume.Name, volume.Backend))
+		}
+		report.OrphanVolumes = append(report.OrphanVolumes, volume.Name)
+		orphansByBackend[volume.Backend]++
+		r.logger.Warning("The ubiquity volume is not used by any PV", logs.Args{{"volume name", volume.Name}, {"backend", volume.Backend}, {"since", since}, {"owned reclaim policy", owned[volume.Name]}})
+	}
+
+	setDriftMetrics(orphansByBackend, missingByStorageClass)
+	sort.Strings(report.OrphanVolumes)
+	sort.Strings(report.MissingVolumes)
+	sort.Strings(report.DeletedVolumes)
+	r.logger.Info("Volumes reconciled", logs.Args{{"orphan volumes", len(report.OrphanVolumes)}, {"missing volumes", len(report.MissingVolumes)}, {"deleted volumes", len(report.DeletedVolumes)}})
+	return report, nil
+}
+
+// deleteOrphan removes the orphan volume and its ownership, unless a PV that uses the volume was created since the PVs were listed.
+func (r *FlexReconciler) deleteOrphan(volume resources.Volume, requestContext resources.RequestContext) error {
+	pvName, err := findVolumePV(r.kubeClient, volume.Name)
+	if err != nil {
+		return r.logger.ErrorRet(err, "failed to get the PV of the orphan volume", logs.Args{{"volume name", volume.Name}})
+	}
+	if pvName != "" {
+		return fmt.Errorf("PV %s uses the volume", pvName)
+	}
+	r.logger.Warning("Deleting the orphan volume", logs.Args{{"volume name", volume.Name}, {"backend", volume.Backend}})
+	start := time.Now()
+	err = r.ubiquityClient.RemoveVolume(resources.RemoveVolumeRequest{Name: volume.Name, Context: requestContext})
+	observeUbiquityCall("RemoveVolume", volume.Backend, "", start, err)
+	if err != nil {
+		return r.logger.ErrorRet(err, "failed to delete the orphan volume", logs.Args{{"volume name", volume.Name}})
+	}
+	if err := r.ownership.Remove(volume.Name); err != nil {
+		r.logger.Error("Failed to remove the ownership of the deleted orphan volume", logs.Args{{"volume name", volume.Name}, {"error", err}})
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+/**
+ * Copyright 2018 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volume_test
+
+import (
+	"fmt"
+	"time"
+
+	k8sresources "github.com/IBM/ubiquity-k8s/resources"
+	"github.com/IBM/ubiquity-k8s/volume"
+	"github.com/IBM/ubiquity/fakes"
+	"github.com/IBM/ubiquity/resources"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Reconciler", func() {
+	var (
+		fakeClient     *fakes.FakeStorageClient
+		fakeKubeClient *k8sfake.Clientset
+		ownership      *volume.VolumeOwnership
+	)
+
+	flexPV := func(name string, driver string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				StorageClassName: "gold",
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					FlexVolume: &v1.FlexVolumeSource{Driver: driver, Options: map[string]string{"volumeName": name}},
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		fakeClient = new(fakes.FakeStorageClient)
+		fakeKubeClient = k8sfake.NewSimpleClientset(
+			flexPV("pv1", k8sresources.UbiquityK8sFlexVolumeDriverFullName),
+			flexPV("pv2", k8sresources.UbiquityK8sFlexVolumeDriverFullName),
+			flexPV("pv3", "other/driver"),
+		)
+		fakeClient.ListVolumesReturns([]resources.Volume{
+			{Name: "pv1", Backend: resources.SCBE},
+			{Name: "pv3", Backend: resources.SCBE},
+			{Name: "vol4", Backend: resources.SCBE},
+		}, nil)
+		ownership = volume.NewVolumeOwnership(fakeKubeClient, "ubiquity", "ubiquity-k8s-provisioner-volumes")
+		Expect(ownership.Add("pv3", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+		Expect(ownership.Add("vol4", v1.PersistentVolumeReclaimDelete)).To(Succeed())
+	})
+
+	Context(".Reconcile", func() {
+		It("reports the orphan volumes and the PVs with missing volumes without deleting them", func() {
+			reconciler := volume.NewFlexReconciler(fakeKubeClient, fakeClient, ownership, false, 0)
+
+			report, err := reconciler.Reconcile()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OrphanVolumes).To(Equal([]string{"pv3", "vol4"}))
+			Expect(report.MissingVolumes).To(Equal([]string{"pv2"}))
+			Expect(report.DeletedVolumes).To(BeEmpty())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+			Expect(metricValue("ubiquity_k8s_provisioner_orphan_volumes", map[string]string{"backend": resources.SCBE})).To(Equal(2.0))
+			Expect(metricValue("ubiquity_k8s_provisioner_missing_volumes", map[string]string{"storage_class": "gold"})).To(Equal(1.0))
+		})
+		It("deletes the orphan volumes after the grace period if it is enabled", func() {
+			reconciler := volume.NewFlexReconciler(fakeKubeClient, fakeClient, ownership, true, 0)
+
+			report, err := reconciler.Reconcile()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.DeletedVolumes).To(Equal([]string{"vol4"}))
+			// A PV named pv3 exists, even though of another driver, so the volume is not deleted.
+			Expect(report.OrphanVolumes).To(Equal([]string{"pv3"}))
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(1))
+			Expect(fakeClient.RemoveVolumeArgsForCall(0).Name).To(Equal("vol4"))
+			_, owned, err := ownership.Get("vol4")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeFalse())
+		})
+		It("does not delete an orphan volume that the provisioner does not own", func() {
+			Expect(ownership.Remove("vol4")).To(Succeed())
+			reconciler := volume.NewFlexReconciler(fakeKubeClient, fakeClient, ownership, true, 0)
+
+			report, err := reconciler.Reconcile()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OrphanVolumes).To(Equal([]string{"pv3", "vol4"}))
+			Expect(report.DeletedVolumes).To(BeEmpty())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+		})
+		It("does not delete an owned orphan volume whose PV was retained", func() {
+			Expect(ownership.Add("vol4", v1.PersistentVolumeReclaimRetain)).To(Succeed())
+			reconciler := volume.NewFlexReconciler(fakeKubeClient, fakeClient, ownership, true, 0)
+
+			report, err := reconciler.Reconcile()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OrphanVolumes).To(Equal([]string{"pv3", "vol4"}))
+			Expect(report.DeletedVolumes).To(BeEmpty())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+		})
+		It("records the ownership of the PVs that the provisioner created", func() {
+			pv := flexPV("pv5", k8sresources.UbiquityK8sFlexVolumeDriverFullName)
+			pv.Annotations = map[string]string{"kubernetes.io/createdby": k8sresources.UbiquityProvisionerName}
+			pv.Spec.PersistentVolumeReclaimPolicy = v1.PersistentVolumeReclaimRetain
+			_, err := fakeKubeClient.CoreV1().PersistentVolumes().Create(pv)
+			Expect(err).ToNot(HaveOccurred())
+			reconciler := volume.NewFlexReconciler(fakeKubeClient, fakeClient, ownership, false, 0)
+
+			_, err = reconciler.Reconcile()
+
+			Expect(err).ToNot(HaveOccurred())
+			reclaimPolicy, owned, err := ownership.Get("pv5")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeTrue())
+			Expect(reclaimPolicy).To(Equal(v1.PersistentVolumeReclaimRetain))
+			_, owned, err = ownership.Get("pv1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(owned).To(BeFalse())
+		})
+		It("does not delete the orphan volumes within the grace period", func() {
+			reconciler := volume.NewFlexReconciler(fakeKubeClient, fakeClient, ownership, true, time.Hour)
+
+			_, err := reconciler.Reconcile()
+			Expect(err).ToNot(HaveOccurred())
+			report, err := reconciler.Reconcile()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OrphanVolumes).To(Equal([]string{"pv3", "vol4"}))
+			Expect(report.DeletedVolumes).To(BeEmpty())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+		})
+		It("fails without reporting drift when the ubiquity volumes cannot be listed", func() {
+			fakeClient.ListVolumesReturns(nil, fmt.Errorf("connection refused"))
+			reconciler := volume.NewFlexReconciler(fakeKubeClient, fakeClient, ownership, true, 0)
+
+			report, err := reconciler.Reconcile()
+
+			Expect(err).To(HaveOccurred())
+			Expect(report.OrphanVolumes).To(BeEmpty())
+			Expect(fakeClient.RemoveVolumeCallCount()).To(Equal(0))
+		})
+	})
+})